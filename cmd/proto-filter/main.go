@@ -1,31 +1,59 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"strings"
 
-	"github.com/jhump/protoreflect/desc"
 	protofilter "github.com/vbfox/proto-filter"
 	"github.com/vbfox/proto-filter/configuration"
 )
 
+// variablesFlag collect the repeated `-var name=value` arguments
+type variablesFlag configuration.Variables
+
+func (v variablesFlag) String() string {
+	parts := []string{}
+	for name, value := range v {
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (v variablesFlag) Set(value string) error {
+	separator := strings.Index(value, "=")
+	if separator <= 0 {
+		return fmt.Errorf("Expected name=value but found '%s'", value)
+	}
+	v[value[:separator]] = value[separator+1:]
+	return nil
+}
+
 func main() {
-	set, err := protofilter.LoadProtoSet("../../test_files/simple.fdset")
+	variables := variablesFlag{}
+	inputPath := flag.String("input", "../../test_files/simple.fdset", "File descriptor set to filter")
+	configPath := flag.String("config", "../../test_files/simple.yml", "Filtering configuration")
+	flag.Var(variables, "var", "Configuration variable in the form name=value (Can be repeated)")
+	flag.Parse()
+
+	set, err := protofilter.LoadProtoSetFiles(*inputPath)
 	if err != nil {
 		fmt.Println("ERR Proto load:", err.Error())
 		return
 	}
 
-	config, err := configuration.LoadConfigurationFile("../../test_files/simple.yml")
+	config, err := configuration.LoadConfigurationFileWithVariables(*configPath, configuration.Variables(variables))
 	if err != nil {
 		fmt.Println("ERR Conf load:", err.Error())
 		return
 	}
 
-	fmt.Println("Loaded set", set.GetFullyQualifiedName())
-	filtered, err := protofilter.FilterSet([]*desc.FileDescriptor{set}, config)
+	fmt.Println("Loaded set", *inputPath)
+	filtered, filterReport, err := protofilter.FilterSetWithReport(set, config)
 	if err != nil {
 		fmt.Println("ERR Filter:", err.Error())
 		return
 	}
+	fmt.Print(filterReport.String())
 	protofilter.OutputSet(filtered)
 }
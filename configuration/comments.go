@@ -0,0 +1,204 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedaction is the text replacing the matches of a replace transform when none is configured
+const DefaultRedaction = "[redacted]"
+
+// CommentTransform change the comments of the output, exactly one of DropParagraph, DropLine or Replace need to be set,
+// all of them are regular expressions:
+//
+// * DropParagraph remove the paragraphs (Separated by empty lines) containing a match.
+// * DropLine remove the lines containing a match.
+// * Replace replace the matches by With, that can reference capture groups ($1, ${name}).
+type CommentTransform struct {
+	DropParagraph string `yaml:"drop_paragraph"`
+	DropLine      string `yaml:"drop_line"`
+	Replace       string `yaml:"replace"`
+	With          string `yaml:"with"`
+
+	regex *regexp.Regexp
+}
+
+// CommentsPolicy decide what happens to the comments of the elements copied to the output
+type CommentsPolicy struct {
+	// Strip remove every comment
+	Strip bool `yaml:"strip"`
+	// StripDetached remove the detached comments, the ones separated from elements by an empty line
+	StripDetached bool `yaml:"strip_detached"`
+	// Transforms are applied in order to every comment
+	Transforms []*CommentTransform `yaml:"transforms"`
+}
+
+func splitLines(comment string) []string {
+	return strings.Split(strings.TrimSuffix(comment, "\n"), "\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// joinLines returns a comment from its lines, without the blank lines left at its start or end
+func joinLines(lines []string) string {
+	for len(lines) > 0 && isBlank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// splitParagraphs returns the paragraphs of a comment, each one with the blank lines that follow it
+func splitParagraphs(lines []string) [][]string {
+	result := [][]string{}
+	var current []string
+	for i, line := range lines {
+		current = append(current, line)
+		if isBlank(line) && (i+1 == len(lines) || !isBlank(lines[i+1])) {
+			result = append(result, current)
+			current = nil
+		}
+	}
+	if current != nil {
+		result = append(result, current)
+	}
+	return result
+}
+
+func (t *CommentTransform) dropParagraphs(regex *regexp.Regexp, comment string) (string, []string) {
+	kept := []string{}
+	redactions := []string{}
+	for _, paragraph := range splitParagraphs(splitLines(comment)) {
+		if regex.MatchString(strings.Join(paragraph, "\n")) {
+			redactions = append(redactions, fmt.Sprintf("Dropped a paragraph matching '%s'", t.DropParagraph))
+		} else {
+			kept = append(kept, paragraph...)
+		}
+	}
+	return joinLines(kept), redactions
+}
+
+func (t *CommentTransform) dropLines(regex *regexp.Regexp, comment string) (string, []string) {
+	kept := []string{}
+	redactions := []string{}
+	for _, line := range splitLines(comment) {
+		if regex.MatchString(line) {
+			redactions = append(redactions, fmt.Sprintf("Dropped a line matching '%s'", t.DropLine))
+		} else {
+			kept = append(kept, line)
+		}
+	}
+	return joinLines(kept), redactions
+}
+
+func (t *CommentTransform) replace(regex *regexp.Regexp, comment string) (string, []string) {
+	matches := regex.FindAllStringIndex(comment, -1)
+	if len(matches) == 0 {
+		return comment, nil
+	}
+
+	with := t.With
+	if with == "" {
+		with = DefaultRedaction
+	}
+	redaction := fmt.Sprintf("Replaced %d match(es) of '%s'", len(matches), t.Replace)
+	return regex.ReplaceAllString(comment, with), []string{redaction}
+}
+
+// getRegex returns the compiled regular expression of the transform, it's only compiled once
+func (t *CommentTransform) getRegex() (*regexp.Regexp, error) {
+	if t.regex == nil {
+		pattern := t.Replace
+		if t.DropParagraph != "" {
+			pattern = t.DropParagraph
+		} else if t.DropLine != "" {
+			pattern = t.DropLine
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid comment regex '%s': %w", pattern, err)
+		}
+		t.regex = regex
+	}
+	return t.regex, nil
+}
+
+// Apply returns the transformed comment and a description of each redaction made
+func (t *CommentTransform) Apply(comment string) (string, []string, error) {
+	if comment == "" {
+		return comment, nil, nil
+	}
+
+	regex, err := t.getRegex()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result string
+	var redactions []string
+	switch {
+	case t.DropParagraph != "":
+		result, redactions = t.dropParagraphs(regex, comment)
+	case t.DropLine != "":
+		result, redactions = t.dropLines(regex, comment)
+	default:
+		result, redactions = t.replace(regex, comment)
+	}
+	return result, redactions, nil
+}
+
+func (t *CommentTransform) Validate() error {
+	set := 0
+	for _, value := range []string{t.DropParagraph, t.DropLine, t.Replace} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("A comment transform need exactly one of drop_paragraph, drop_line or replace")
+	}
+
+	_, err := t.getRegex()
+	return err
+}
+
+// Transform apply every transform to a comment, returning the new comment and a description of each redaction made.
+// Comments that end up blank are removed.
+func (p *CommentsPolicy) Transform(comment string) (string, []string, error) {
+	if p.Strip {
+		return "", nil, nil
+	}
+
+	redactions := []string{}
+	for _, transform := range p.Transforms {
+		var transformRedactions []string
+		var err error
+		comment, transformRedactions, err = transform.Apply(comment)
+		if err != nil {
+			return "", nil, err
+		}
+		redactions = append(redactions, transformRedactions...)
+	}
+
+	if isBlank(comment) {
+		comment = ""
+	}
+	return comment, redactions, nil
+}
+
+func (p *CommentsPolicy) Validate() error {
+	for i, transform := range p.Transforms {
+		if err := transform.Validate(); err != nil {
+			return fmt.Errorf("transforms[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -15,9 +15,71 @@ func NewFilterTreeNode(name string, children ...*FilterTreeNode) *FilterTreeNode
 	}
 }
 
+// OneOfPolicy decide what happens to a oneof that lost members during filtering and ends up with zero or one member
+type OneOfPolicy string
+
+const (
+	// OneOfPolicyKeep keep the remaining member
+	OneOfPolicyKeep OneOfPolicy = "keep"
+	// OneOfPolicyDrop remove the remaining member
+	OneOfPolicyDrop OneOfPolicy = "drop"
+	// OneOfPolicyError fail the filtering
+	OneOfPolicyError OneOfPolicy = "error"
+	// OneOfPolicyFlatten output the remaining member as a normal field
+	OneOfPolicyFlatten OneOfPolicy = "flatten"
+)
+
+func (p OneOfPolicy) IsValid() bool {
+	return p == OneOfPolicyKeep || p == OneOfPolicyDrop || p == OneOfPolicyError || p == OneOfPolicyFlatten
+}
+
+// Ordering decide the order of the elements in the output
+type Ordering string
+
+const (
+	// OrderingInput keep the order of the input
+	OrderingInput Ordering = "input"
+	// OrderingAlphabetical sort files, messages, fields, enums, services, methods and extensions by name
+	OrderingAlphabetical Ordering = "alphabetical"
+)
+
+func (o Ordering) IsValid() bool {
+	return o == OrderingInput || o == OrderingAlphabetical
+}
+
 type Configuration struct {
 	Include []*FilterTreeNode
 	Exclude []*FilterTreeNode
+	// CascadeExclusions remove any field or method referencing an excluded type instead of failing
+	CascadeExclusions bool
+	// AllowRequiredFieldRemoval report excluded proto2 required fields as warnings instead of failing
+	AllowRequiredFieldRemoval bool
+	// ReserveRemoved add a reserved entry for the number of every field and enum value removed by filtering
+	ReserveRemoved bool
+	OneOfPolicy    OneOfPolicy
+	Selectors      []*SelectorRule
+	Options        OptionsFilter
+	// OptionRules rewrite the options of the elements they match, every matching rule is applied in order
+	OptionRules []*OptionRule
+	// External are the dependencies that are only referenced by imports, never filtered or output
+	External ExternalDependencies
+	Ordering Ordering
+	// Packages are renamed in the output by the first rule that applies to them
+	Packages []*PackageRename
+	// Paths rewrite the paths of the output files, the first rule that applies to a file is used
+	Paths []*PathRewrite
+	// Substitutions replace the type of fields, the first substitution matching a field is used
+	Substitutions []*TypeSubstitution
+	// Layout decide how the filtered elements are grouped in output files
+	Layout Layout
+	// Comments transform the comments of the output
+	Comments CommentsPolicy
+	// Renames change the names of elements in the output, the first rule matching an element is used
+	Renames []*RenameRule
+	// Hoisting move the nested types of messages that are only kept to contain them to the top level
+	Hoisting Hoisting
+	// Deprecations mark elements as deprecated in the output, the first rule matching an element is used
+	Deprecations []*DeprecationRule
 }
 
 func NewConfiguration(include []*FilterTreeNode, exclude []*FilterTreeNode) *Configuration {
@@ -28,9 +90,75 @@ func NewConfiguration(include []*FilterTreeNode, exclude []*FilterTreeNode) *Con
 		exclude = []*FilterTreeNode{}
 	}
 	return &Configuration{
-		Include: include,
-		Exclude: exclude,
+		Include:       include,
+		Exclude:       exclude,
+		OneOfPolicy:   OneOfPolicyKeep,
+		Selectors:     []*SelectorRule{},
+		OptionRules:   []*OptionRule{},
+		External:      DefaultExternalDependencies(),
+		Ordering:      OrderingInput,
+		Packages:      []*PackageRename{},
+		Paths:         []*PathRewrite{},
+		Substitutions: []*TypeSubstitution{},
+		Renames:       []*RenameRule{},
+		Deprecations:  []*DeprecationRule{},
+		Layout:        DefaultLayout(),
+	}
+}
+
+func (node *FilterTreeNode) clone() *FilterTreeNode {
+	return NewFilterTreeNode(node.Name, cloneFilterTree(node.Children)...)
+}
+
+func cloneFilterTree(nodes []*FilterTreeNode) []*FilterTreeNode {
+	result := make([]*FilterTreeNode, len(nodes))
+	for i, node := range nodes {
+		result[i] = node.clone()
 	}
+	return result
+}
+
+// Clone returns a copy of the configuration where the filter trees can be modified independently
+func (config *Configuration) Clone() *Configuration {
+	result := *config
+	result.Include = cloneFilterTree(config.Include)
+	result.Exclude = cloneFilterTree(config.Exclude)
+	return &result
+}
+
+// addTreePath add a leaf to a filter tree, if a parent of the path is already a leaf nothing is changed
+func addTreePath(nodes []*FilterTreeNode, path []string) []*FilterTreeNode {
+	node := findTreeNode(nodes, path[0])
+
+	if node == nil {
+		node = NewFilterTreeNode(path[0])
+		nodes = append(nodes, node)
+		if len(path) > 1 {
+			node.Children = addTreePath(node.Children, path[1:])
+		}
+		return nodes
+	}
+
+	if node.isLeaf() {
+		return nodes
+	}
+
+	if len(path) == 1 {
+		node.Children = []*FilterTreeNode{}
+	} else {
+		node.Children = addTreePath(node.Children, path[1:])
+	}
+	return nodes
+}
+
+// AddIncludedPath include an element and all its children as if it was listed in the configuration
+func (config *Configuration) AddIncludedPath(path ...string) {
+	config.Include = addTreePath(config.Include, path)
+}
+
+// AddExcludedPath exclude an element as if it was listed in the configuration
+func (config *Configuration) AddExcludedPath(path ...string) {
+	config.Exclude = addTreePath(config.Exclude, path)
 }
 
 type InclusionResult int
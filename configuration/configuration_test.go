@@ -46,3 +46,238 @@ func TestElementInFileIncluded(t *testing.T) {
 	result := config.IsIncluded("foo.proto", "bar")
 	assert.Equal(t, result, UnknownInclusion)
 }
+
+func TestAddIncludedPath(t *testing.T) {
+	include := []*FilterTreeNode{
+		NewFilterTreeNode("foo.proto", NewFilterTreeNode("Bar")),
+	}
+
+	config := NewConfiguration(include, nil)
+	clone := config.Clone()
+	clone.AddIncludedPath("foo.proto", "Baz", "field")
+	clone.AddIncludedPath("foo.proto", "Bar", "field")
+
+	assert.Equal(t, IncludedWithChildren, clone.IsIncluded("foo.proto", "Baz", "field"))
+	assert.Equal(t, IncludedWithoutChildren, clone.IsIncluded("foo.proto", "Baz"))
+	assert.Equal(t, IncludedWithChildren, clone.IsIncluded("foo.proto", "Bar"))
+	assert.Equal(t, UnknownInclusion, config.IsIncluded("foo.proto", "Baz"))
+}
+
+func TestAddExcludedPath(t *testing.T) {
+	include := []*FilterTreeNode{
+		NewFilterTreeNode("foo.proto", NewFilterTreeNode("Bar")),
+	}
+
+	config := NewConfiguration(include, nil)
+	config.AddExcludedPath("foo.proto", "Bar", "field")
+
+	assert.Equal(t, IncludedWithChildren, config.IsIncluded("foo.proto", "Bar"))
+	assert.Equal(t, Excluded, config.IsIncluded("foo.proto", "Bar", "field"))
+}
+
+func TestOptionsFilterIsAllowed(t *testing.T) {
+	empty := OptionsFilter{}
+	assert.True(t, empty.IsAllowed("deprecated"))
+	assert.True(t, empty.IsAllowed("acme.owner_team"))
+
+	deny := OptionsFilter{Deny: []string{"(acme.owner_team)", "java_*"}}
+	assert.False(t, deny.IsAllowed("acme.owner_team"))
+	assert.False(t, deny.IsAllowed("(acme.owner_team)"))
+	assert.False(t, deny.IsAllowed("java_package"))
+	assert.True(t, deny.IsAllowed("go_package"))
+
+	allow := OptionsFilter{Allow: []string{"deprecated", "(acme.*)"}, Deny: []string{"acme.internal"}}
+	assert.True(t, allow.IsAllowed("deprecated"))
+	assert.True(t, allow.IsAllowed("acme.owner_team"))
+	assert.False(t, allow.IsAllowed("acme.internal"))
+	assert.False(t, allow.IsAllowed("packed"))
+}
+
+func TestPackageRename(t *testing.T) {
+	rename := &PackageRename{From: "acme.internal", To: "acme"}
+
+	renamed, applies := rename.Rename("acme.internal")
+	assert.True(t, applies)
+	assert.Equal(t, "acme", renamed)
+
+	renamed, applies = rename.Rename("acme.internal.search.v1")
+	assert.True(t, applies)
+	assert.Equal(t, "acme.search.v1", renamed)
+
+	_, applies = rename.Rename("acme.internalfoo")
+	assert.False(t, applies)
+}
+
+func TestPackageTemplateData(t *testing.T) {
+	data := NewPackageTemplateData("acme.search_api.v1", "search.proto")
+
+	assert.Equal(t, "acme/search_api/v1", data.PackagePath)
+	assert.Equal(t, "v1", data.PackageName)
+	assert.Equal(t, "Acme.SearchApi.V1", data.PascalPackage)
+}
+
+func TestPathRewrite(t *testing.T) {
+	config := NewConfiguration(nil, nil)
+	config.Paths = []*PathRewrite{
+		{Prefix: "acme/internal/", Replacement: "acme/"},
+		{Regex: `^internal/(\w+)/(.*)$`, Replacement: "public/$1-$2"},
+		{Flatten: "other"},
+	}
+
+	assertRewrite := func(expected string, filePath string) {
+		actual, err := config.RewritePath(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	assertRewrite("acme/search/api.proto", "acme/internal/search/api.proto")
+	assertRewrite("public/search-api.proto", "internal/search/api.proto")
+	assertRewrite("other/api.proto", "foo/bar/api.proto")
+}
+
+func TestPathRewritePrefixBoundary(t *testing.T) {
+	config := NewConfiguration(nil, nil)
+	config.Paths = []*PathRewrite{
+		{Prefix: "api", Replacement: "public"},
+	}
+
+	path, err := config.RewritePath("api/search.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, "public/search.proto", path)
+
+	path, err = config.RewritePath("apiv2/search.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, "apiv2/search.proto", path)
+}
+
+func TestPathRewriteInvalidRegex(t *testing.T) {
+	config := NewConfiguration(nil, nil)
+	config.Paths = []*PathRewrite{
+		{Regex: `^(internal`, Replacement: "public"},
+	}
+
+	_, err := config.RewritePath("internal/search.proto")
+	assert.Error(t, err)
+}
+
+func TestLayoutRenderPath(t *testing.T) {
+	layout := Layout{Mode: LayoutType}
+	path, err := layout.RenderPath(NewLayoutTemplateData("acme.search.v1", "search.proto", "HTTPSearchRequest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/search/v1/http_search_request.proto", path)
+
+	path, err = layout.RenderPath(NewLayoutTemplateData("", "search.proto", "msg_a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "msg_a.proto", path)
+
+	layout = Layout{Mode: LayoutPackage}
+	path, err = layout.RenderPath(NewLayoutTemplateData("acme.search.v1", "search.proto", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/search/v1.proto", path)
+
+	path, err = layout.RenderPath(NewLayoutTemplateData("", "search.proto", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, NoPackageLayoutPath, path)
+
+	layout = Layout{Mode: LayoutPackage, Path: "{{.PackagePath}}/{{.PackageName}}.proto"}
+	path, err = layout.RenderPath(NewLayoutTemplateData("acme.search.v1", "search.proto", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/search/v1/v1.proto", path)
+
+	layout = Layout{Mode: LayoutPackage, Path: "{{.Unknown}}.proto"}
+	_, err = layout.RenderPath(NewLayoutTemplateData("acme", "search.proto", ""))
+	assert.Error(t, err)
+}
+
+func TestLayoutValidate(t *testing.T) {
+	layout := Layout{Mode: LayoutBundle}
+	assert.NoError(t, layout.Validate())
+	assert.NoError(t, layout.Validate())
+	assert.Equal(t, Layout{Mode: LayoutBundle}, layout)
+
+	layout = Layout{}
+	assert.Error(t, layout.Validate())
+	layout = layout.withDefaults()
+	assert.NoError(t, layout.Validate())
+	assert.Equal(t, DefaultLayout(), layout)
+}
+
+func TestCommentsPolicyTransform(t *testing.T) {
+	policy := CommentsPolicy{
+		Transforms: []*CommentTransform{
+			{DropParagraph: "INTERNAL:"},
+			{DropLine: "TODO"},
+			{Replace: `[a-z0-9-]+\.corp\.acme\.com`},
+			{Replace: `ticket ([A-Z]+)-\d+`, With: "ticket $1-XXX"},
+		},
+	}
+
+	comment, redactions, err := policy.Transform(` Search for documents.
+ TODO(alice): hack
+
+ INTERNAL: Served by search-1.corp.acme.com
+ see the runbook
+
+ Served by search-2.corp.acme.com, see ticket SRCH-1234
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, ` Search for documents.
+
+ Served by [redacted], see ticket SRCH-XXX
+`, comment)
+	assert.Equal(t, []string{
+		"Dropped a paragraph matching 'INTERNAL:'",
+		"Dropped a line matching 'TODO'",
+		`Replaced 1 match(es) of '[a-z0-9-]+\.corp\.acme\.com'`,
+		`Replaced 1 match(es) of 'ticket ([A-Z]+)-\d+'`,
+	}, redactions)
+
+	comment, redactions, err = policy.Transform(" TODO: remove\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "", comment)
+	assert.Len(t, redactions, 1)
+
+	policy.Strip = true
+	comment, redactions, err = policy.Transform(" Search for documents.\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "", comment)
+	assert.Empty(t, redactions)
+}
+
+func TestCommentsPolicyInvalidRegex(t *testing.T) {
+	policy := CommentsPolicy{
+		Transforms: []*CommentTransform{
+			{DropLine: "TODO("},
+		},
+	}
+
+	_, _, err := policy.Transform(" TODO(alice): hack\n")
+	assert.Error(t, err)
+}
+
+func TestRenameRule(t *testing.T) {
+	assertRename := func(rule RenameRule, expected string, name string) {
+		actual, err := rule.Rename(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	rule := RenameRule{To: "Item"}
+	assertRename(rule, "Item", "msg_b")
+
+	rule = RenameRule{Regex: `^Internal(\w+)$`, Replacement: "${1}"}
+	assertRename(rule, "Request", "InternalRequest")
+	assertRename(rule, "Response", "Response")
+
+	rule = RenameRule{Regex: `^internal_`, Replacement: "1_"}
+	_, err := rule.Rename("internal_id")
+	assert.Error(t, err)
+
+	rule = RenameRule{Regex: `^internal_id$`, Replacement: ""}
+	_, err = rule.Rename("internal_id")
+	assert.Error(t, err)
+
+	rule = RenameRule{Regex: `^(internal`, Replacement: ""}
+	_, err = rule.Rename("internal_id")
+	assert.Error(t, err)
+}
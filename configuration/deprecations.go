@@ -0,0 +1,21 @@
+package configuration
+
+import "fmt"
+
+// DeprecationRule mark the elements matched by a selector as deprecated in the output, Notice is prepended to their
+// comments when set
+type DeprecationRule struct {
+	Match  Selector `yaml:"match"`
+	Notice string   `yaml:"notice"`
+}
+
+func (r *DeprecationRule) Validate() error {
+	switch r.Match.Kind {
+	case "", ElementKindMessage, ElementKindField, ElementKindExtension, ElementKindEnum, ElementKindEnumValue,
+		ElementKindService, ElementKindMethod:
+	default:
+		return fmt.Errorf("Deprecations can't match %s", r.Match.Kind)
+	}
+
+	return r.Match.Validate()
+}
@@ -0,0 +1,53 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+)
+
+// WellKnownTypesPackage is the package of the well-known types, always external unless FilterWellKnownTypes is set
+const WellKnownTypesPackage = "google.protobuf"
+
+// ExternalDependencies list the files that are never filtered or output, they are only referenced by imports. Files
+// can be matched by their name or by their package, Glob patterns can be used.
+type ExternalDependencies struct {
+	Files    []string `yaml:"files"`
+	Packages []string `yaml:"packages"`
+	// FilterWellKnownTypes filter the well-known types like any other file instead of keeping them external
+	FilterWellKnownTypes bool `yaml:"filter_well_known_types"`
+}
+
+// DefaultExternalDependencies returns the external dependencies used when the configuration doesn't specify any, only
+// the well-known types are external
+func DefaultExternalDependencies() ExternalDependencies {
+	return ExternalDependencies{
+		Files:    []string{},
+		Packages: []string{},
+	}
+}
+
+func matchesAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExternal returns true if a file is an external dependency
+func (e *ExternalDependencies) IsExternal(fileName string, packageName string) bool {
+	if packageName == WellKnownTypesPackage && !e.FilterWellKnownTypes {
+		return true
+	}
+	return matchesAnyPattern(e.Files, fileName) || matchesAnyPattern(e.Packages, packageName)
+}
+
+func (e *ExternalDependencies) Validate() error {
+	for _, pattern := range append(append([]string{}, e.Files...), e.Packages...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid external pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
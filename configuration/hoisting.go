@@ -0,0 +1,18 @@
+package configuration
+
+import "fmt"
+
+// Hoisting move the nested messages and enums whose parents are only kept to contain them to the top level, the
+// parents are then removed from the output
+type Hoisting struct {
+	Enabled bool `yaml:"enabled"`
+	// File is the input file where the hoisted types are moved, by default they stay in their own file
+	File string `yaml:"file"`
+}
+
+func (h *Hoisting) Validate() error {
+	if h.File != "" && !h.Enabled {
+		return fmt.Errorf("A hoisting file can only be used when hoisting is enabled")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// LayoutMode decide how the filtered elements are grouped in output files
+type LayoutMode string
+
+const (
+	// LayoutFiles output each input file as a file
+	LayoutFiles LayoutMode = "files"
+	// LayoutBundle merge every filtered file in a single file
+	LayoutBundle LayoutMode = "bundle"
+	// LayoutPackage output a file per package
+	LayoutPackage LayoutMode = "package"
+	// LayoutType output a file per top level message, enum or service
+	LayoutType LayoutMode = "type"
+)
+
+func (m LayoutMode) IsValid() bool {
+	return m == LayoutFiles || m == LayoutBundle || m == LayoutPackage || m == LayoutType
+}
+
+const (
+	// DefaultBundlePath is the path of the output file in bundle mode when none is configured
+	DefaultBundlePath = "bundle.proto"
+	// DefaultPackageLayoutPath is the path template of the output files in package mode when none is configured
+	DefaultPackageLayoutPath = "{{.PackagePath}}.proto"
+	// DefaultTypeLayoutPath is the path template of the output files in type mode when none is configured
+	DefaultTypeLayoutPath = "{{.PackagePath}}/{{.SnakeType}}.proto"
+	// NoPackageLayoutPath is the path of the output file for the files without package in package mode
+	NoPackageLayoutPath = "default.proto"
+	// ExtensionsLayoutType is the type name used for the file containing the top level extensions in type mode
+	ExtensionsLayoutType = "extensions"
+)
+
+// Layout control the output files, path rewrites are applied to the paths it produces
+type Layout struct {
+	Mode LayoutMode `yaml:"mode"`
+	// Bundle is the path of the single output file in bundle mode
+	Bundle string `yaml:"bundle"`
+	// Path is the text/template of the output file paths in package and type modes, executed with a
+	// LayoutTemplateData
+	Path string `yaml:"path"`
+}
+
+// LayoutTemplateData is available to the path template of the package and type layouts
+type LayoutTemplateData struct {
+	PackageTemplateData
+	// Type is the name of the top level element placed in the file in type mode (SearchRequest)
+	Type string
+	// SnakeType is the name of the top level element in snake case (search_request)
+	SnakeType string
+}
+
+// NewLayoutTemplateData create the data available to the path template for an element of a file, the type is empty
+// in package mode
+func NewLayoutTemplateData(packageName string, fileName string, typeName string) LayoutTemplateData {
+	return LayoutTemplateData{
+		PackageTemplateData: NewPackageTemplateData(packageName, fileName),
+		Type:                typeName,
+		SnakeType:           toSnakeCase(typeName),
+	}
+}
+
+func toSnakeCase(name string) string {
+	var result strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			previousIsLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextIsLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if previousIsLower || nextIsLower {
+				result.WriteRune('_')
+			}
+			result.WriteRune(unicode.ToLower(r))
+		} else {
+			result.WriteRune(r)
+		}
+	}
+	return result.String()
+}
+
+// DefaultLayout returns the layout used when the configuration doesn't specify any: one output file per input file
+func DefaultLayout() Layout {
+	return Layout{
+		Mode:   LayoutFiles,
+		Bundle: DefaultBundlePath,
+	}
+}
+
+func (l *Layout) getPathTemplate() string {
+	if l.Path != "" {
+		return l.Path
+	}
+	if l.Mode == LayoutType {
+		return DefaultTypeLayoutPath
+	}
+	return DefaultPackageLayoutPath
+}
+
+// RenderPath returns the path of an output file in package and type modes
+func (l *Layout) RenderPath(data LayoutTemplateData) (string, error) {
+	if l.Mode == LayoutPackage && data.Package == "" {
+		return NoPackageLayoutPath, nil
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(l.getPathTemplate())
+	if err != nil {
+		return "", fmt.Errorf("Invalid layout path template: %w", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", fmt.Errorf("Failed to render layout path: %w", err)
+	}
+	return strings.TrimPrefix(result.String(), "/"), nil
+}
+
+// withDefaults returns the layout with the values that aren't configured taken from the default layout
+func (l Layout) withDefaults() Layout {
+	defaults := DefaultLayout()
+	if l.Mode == "" {
+		l.Mode = defaults.Mode
+	}
+	if l.Bundle == "" {
+		l.Bundle = defaults.Bundle
+	}
+	return l
+}
+
+func (l *Layout) Validate() error {
+	if !l.Mode.IsValid() {
+		return fmt.Errorf("Unknown layout mode: %s", l.Mode)
+	}
+	if _, err := template.New("path").Parse(l.getPathTemplate()); err != nil {
+		return fmt.Errorf("Invalid layout path template: %w", err)
+	}
+	return nil
+}
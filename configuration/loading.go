@@ -28,18 +28,36 @@ bar: c
 }
 
 type filterTreeYaml struct {
-	Name     string
-	Children []*filterTreeYaml
+	Name string
+	// Condition is set for `when` nodes, their children are only kept if it evaluates to true
+	Condition string
+	Children  []*filterTreeYaml
 }
 
-func (v *filterTreeYaml) ToFilterTree() *FilterTreeNode {
-	var children []*FilterTreeNode
+// ToFilterTree expand the variables and conditions of the node, producing zero, one or many filter tree nodes
+func (v *filterTreeYaml) ToFilterTree(variables Variables) ([]*FilterTreeNode, error) {
+	if v.Condition != "" {
+		include, err := evaluateCondition(v.Condition, variables)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			return []*FilterTreeNode{}, nil
+		}
+		return filterTreeYamlArrayToFilterTreeArray(v.Children, variables)
+	}
+
+	name, err := variables.expand(v.Name)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, childNode := range v.Children {
-		children = append(children, childNode.ToFilterTree())
+	children, err := filterTreeYamlArrayToFilterTreeArray(v.Children, variables)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
-	return NewFilterTreeNode(v.Name, children...)
+	return []*FilterTreeNode{NewFilterTreeNode(name, children...)}, nil
 }
 
 func prettyPrint(i interface{}) string {
@@ -60,7 +78,7 @@ func yamlNodeToFilterTree(node ast.Node) (*filterTreeYaml, error) {
 
 	case ast.IntegerType:
 		integerNode := node.(*ast.IntegerNode)
-		name := string(integerNode.GetValue().(int64))
+		name := fmt.Sprint(integerNode.GetValue())
 		return &filterTreeYaml{Name: name}, nil
 
 	case ast.MappingValueType:
@@ -90,11 +108,60 @@ func yamlNodeToFilterTree(node ast.Node) (*filterTreeYaml, error) {
 		}
 
 		return &filterTreeYaml{Name: name, Children: children}, nil
+
+	case ast.MappingType:
+		return yamlConditionToFilterTree(node.(*ast.MappingNode))
+
 	default:
 		return nil, fmt.Errorf("Not supported key type: %v", node.Type())
 	}
 }
 
+// yamlConditionToFilterTree parse a conditional node in the form `{ when: <condition>, then: [<nodes>] }`
+func yamlConditionToFilterTree(node *ast.MappingNode) (*filterTreeYaml, error) {
+	result := &filterTreeYaml{}
+	hasThen := false
+
+	for _, value := range node.Values {
+		if value.Key.Type() != ast.StringType {
+			return nil, fmt.Errorf("Expected a string key but found: %v", value.Key.Type())
+		}
+
+		key := value.Key.(*ast.StringNode).Value
+		switch key {
+		case "when":
+			if value.Value.Type() != ast.StringType {
+				return nil, fmt.Errorf("Expected a string condition but found: %v", value.Value.Type())
+			}
+			result.Condition = value.Value.(*ast.StringNode).Value
+
+		case "then":
+			if value.Value.Type() != ast.SequenceType {
+				return nil, fmt.Errorf("Expected a sequence of values but found: %v", value.Value.Type())
+			}
+			hasThen = true
+			for _, childNode := range value.Value.(*ast.SequenceNode).Values {
+				child, childErr := yamlNodeToFilterTree(childNode)
+				if childErr != nil {
+					return nil, fmt.Errorf("then: %w", childErr)
+				}
+				if child != nil {
+					result.Children = append(result.Children, child)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("Unexpected key '%s' in conditional node", key)
+		}
+	}
+
+	if result.Condition == "" || !hasThen {
+		return nil, fmt.Errorf("A conditional node requires both 'when' and 'then'")
+	}
+
+	return result, nil
+}
+
 func deserializeFilterTreeYaml(raw string) (*filterTreeYaml, error) {
 	tokens := lexer.Tokenize(raw)
 	f, err := parser.Parse(tokens, 0)
@@ -122,39 +189,180 @@ func (v *filterTreeYaml) UnmarshalYAML(raw []byte) error {
 }
 
 type configurationYaml struct {
-	Include []*filterTreeYaml `yaml:"include"`
-	Exclude []*filterTreeYaml `yaml:"exclude"`
+	Variables map[string]string `yaml:"variables"`
+	Include   []*filterTreeYaml `yaml:"include"`
+	Exclude   []*filterTreeYaml `yaml:"exclude"`
+
+	CascadeExclusions         bool   `yaml:"cascade_exclusions"`
+	AllowRequiredFieldRemoval bool   `yaml:"allow_required_field_removal"`
+	ReserveRemoved            bool   `yaml:"reserve_removed"`
+	OneOfPolicy               string `yaml:"oneof_policy"`
+	Ordering                  string `yaml:"ordering"`
+
+	Selectors []*SelectorRule `yaml:"selectors"`
+	Options   OptionsFilter   `yaml:"options"`
+
+	OptionRules []*OptionRule `yaml:"option_rules"`
+
+	External *ExternalDependencies `yaml:"external"`
+	Packages []*PackageRename      `yaml:"packages"`
+	Paths    []*PathRewrite        `yaml:"paths"`
+
+	Substitutions []*TypeSubstitution `yaml:"substitutions"`
+	Layout        *Layout             `yaml:"layout"`
+	Comments      CommentsPolicy      `yaml:"comments"`
+	Renames       []*RenameRule       `yaml:"renames"`
+	Hoisting      Hoisting            `yaml:"hoisting"`
+	Deprecations  []*DeprecationRule  `yaml:"deprecations"`
 }
 
-func filterTreeYamlArrayToFilterTreeArray(yaml []*filterTreeYaml) []*FilterTreeNode {
+func filterTreeYamlArrayToFilterTreeArray(yaml []*filterTreeYaml, variables Variables) ([]*FilterTreeNode, error) {
 	var result []*FilterTreeNode
 
 	for _, childNode := range yaml {
-		result = append(result, childNode.ToFilterTree())
+		nodes, err := childNode.ToFilterTree(variables)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, nodes...)
 	}
 
-	return result
+	return result, nil
 }
 
 func LoadConfiguration(content []byte) (*Configuration, error) {
+	return LoadConfigurationWithVariables(content, nil)
+}
+
+// LoadConfigurationWithVariables load a configuration, expanding `${name}` references and `when` conditions using
+// the supplied variables and the defaults declared in the `variables` section.
+func LoadConfigurationWithVariables(content []byte, variables Variables) (*Configuration, error) {
 	var config configurationYaml
 	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
 		return nil, err
 	}
 
-	result := NewConfiguration(
-		filterTreeYamlArrayToFilterTreeArray(config.Include),
-		filterTreeYamlArrayToFilterTreeArray(config.Exclude),
-	)
+	allVariables := mergeVariables(config.Variables, variables)
+
+	include, err := filterTreeYamlArrayToFilterTreeArray(config.Include, allVariables)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+
+	exclude, err := filterTreeYamlArrayToFilterTreeArray(config.Exclude, allVariables)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+
+	result := NewConfiguration(include, exclude)
+	result.CascadeExclusions = config.CascadeExclusions
+	result.AllowRequiredFieldRemoval = config.AllowRequiredFieldRemoval
+	result.ReserveRemoved = config.ReserveRemoved
+	if config.OneOfPolicy != "" {
+		result.OneOfPolicy = OneOfPolicy(config.OneOfPolicy)
+		if !result.OneOfPolicy.IsValid() {
+			return nil, fmt.Errorf("Unknown oneof_policy: %s", config.OneOfPolicy)
+		}
+	}
+
+	if config.Ordering != "" {
+		result.Ordering = Ordering(config.Ordering)
+		if !result.Ordering.IsValid() {
+			return nil, fmt.Errorf("Unknown ordering: %s", config.Ordering)
+		}
+	}
+
+	for i, selector := range config.Selectors {
+		if err := selector.Validate(); err != nil {
+			return nil, fmt.Errorf("selectors[%d]: %w", i, err)
+		}
+		result.Selectors = append(result.Selectors, selector)
+	}
+
+	if err := config.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("options: %w", err)
+	}
+	result.Options = config.Options
+
+	for i, rule := range config.OptionRules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("option_rules[%d]: %w", i, err)
+		}
+		result.OptionRules = append(result.OptionRules, rule)
+	}
+
+	if config.External != nil {
+		if err := config.External.Validate(); err != nil {
+			return nil, fmt.Errorf("external: %w", err)
+		}
+		result.External = *config.External
+	}
+
+	for i, rename := range config.Packages {
+		if err := rename.Validate(); err != nil {
+			return nil, fmt.Errorf("packages[%d]: %w", i, err)
+		}
+		result.Packages = append(result.Packages, rename)
+	}
+
+	for i, rewrite := range config.Paths {
+		if err := rewrite.Validate(); err != nil {
+			return nil, fmt.Errorf("paths[%d]: %w", i, err)
+		}
+		result.Paths = append(result.Paths, rewrite)
+	}
+
+	for i, substitution := range config.Substitutions {
+		if err := substitution.Validate(); err != nil {
+			return nil, fmt.Errorf("substitutions[%d]: %w", i, err)
+		}
+		result.Substitutions = append(result.Substitutions, substitution)
+	}
+
+	if config.Layout != nil {
+		layout := config.Layout.withDefaults()
+		if err := layout.Validate(); err != nil {
+			return nil, fmt.Errorf("layout: %w", err)
+		}
+		result.Layout = layout
+	}
+
+	if err := config.Comments.Validate(); err != nil {
+		return nil, fmt.Errorf("comments: %w", err)
+	}
+	result.Comments = config.Comments
+
+	for i, rename := range config.Renames {
+		if err := rename.Validate(); err != nil {
+			return nil, fmt.Errorf("renames[%d]: %w", i, err)
+		}
+		result.Renames = append(result.Renames, rename)
+	}
+
+	if err := config.Hoisting.Validate(); err != nil {
+		return nil, fmt.Errorf("hoisting: %w", err)
+	}
+	result.Hoisting = config.Hoisting
+
+	for i, deprecation := range config.Deprecations {
+		if err := deprecation.Validate(); err != nil {
+			return nil, fmt.Errorf("deprecations[%d]: %w", i, err)
+		}
+		result.Deprecations = append(result.Deprecations, deprecation)
+	}
 
 	return result, nil
 }
 
 func LoadConfigurationFile(path string) (*Configuration, error) {
+	return LoadConfigurationFileWithVariables(path, nil)
+}
+
+func LoadConfigurationFileWithVariables(path string, variables Variables) (*Configuration, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("Can't load file %s: %w", path, err)
 	}
 
-	return LoadConfiguration(content)
+	return LoadConfigurationWithVariables(content, variables)
 }
@@ -81,3 +81,507 @@ exclude:
 	assert.Equal(exclude1.Children[0].Children[0].Name, "*")
 	assert.True(exclude1.Children[0].Children[0].isLeaf())
 }
+
+func TestLoadingVariables(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+variables:
+    partner: default
+include:
+    - test.proto:
+        - msg_${partner}
+`
+	result, err := LoadConfigurationWithVariables([]byte(yml), Variables{"partner": "acme"})
+	assert.NoError(err)
+	assert.Len(result.Include, 1)
+	assert.Len(result.Include[0].Children, 1)
+	assert.Equal("msg_acme", result.Include[0].Children[0].Name)
+
+	result, err = LoadConfiguration([]byte(yml))
+	assert.NoError(err)
+	assert.Equal("msg_default", result.Include[0].Children[0].Name)
+}
+
+func TestLoadingConditions(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+include:
+    - test.proto:
+        - msg_a
+        - when: partner == "acme"
+          then:
+            - msg_acme
+        - when: partner != "acme"
+          then:
+            - msg_other
+`
+	result, err := LoadConfigurationWithVariables([]byte(yml), Variables{"partner": "acme"})
+	assert.NoError(err)
+	assert.Len(result.Include, 1)
+	children := result.Include[0].Children
+	assert.Len(children, 2)
+	assert.Equal("msg_a", children[0].Name)
+	assert.Equal("msg_acme", children[1].Name)
+
+	result, err = LoadConfigurationWithVariables([]byte(yml), Variables{"partner": "globex"})
+	assert.NoError(err)
+	children = result.Include[0].Children
+	assert.Len(children, 2)
+	assert.Equal("msg_a", children[0].Name)
+	assert.Equal("msg_other", children[1].Name)
+}
+
+func TestLoadingTopLevelCondition(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+exclude:
+    - when: "!internal"
+      then:
+        - test.proto:
+            - msg_internal
+`
+	result, err := LoadConfigurationWithVariables([]byte(yml), Variables{"internal": "false"})
+	assert.NoError(err)
+	assert.Len(result.Exclude, 1)
+	assert.Equal("test.proto", result.Exclude[0].Name)
+
+	result, err = LoadConfigurationWithVariables([]byte(yml), Variables{"internal": "true"})
+	assert.NoError(err)
+	assert.Empty(result.Exclude)
+}
+
+func TestLoadingUndefinedVariable(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+include:
+    - test.proto:
+        - msg_${partner}
+`
+	_, err := LoadConfiguration([]byte(yml))
+	assert.Error(err)
+
+	yml = `
+include:
+    - when: partner == "acme"
+      then:
+        - test.proto
+`
+	_, err = LoadConfiguration([]byte(yml))
+	assert.Error(err)
+}
+
+func TestLoadingNumericField(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+include:
+    - test.proto:
+        - msg_a:
+            - 3
+`
+	result, err := LoadConfiguration([]byte(yml))
+	assert.NoError(err)
+	assert.Equal("3", result.Include[0].Children[0].Children[0].Name)
+}
+
+func TestLoadingOneOfPolicy(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(``))
+	assert.NoError(err)
+	assert.Equal(OneOfPolicyKeep, result.OneOfPolicy)
+
+	result, err = LoadConfiguration([]byte(`oneof_policy: drop`))
+	assert.NoError(err)
+	assert.Equal(OneOfPolicyDrop, result.OneOfPolicy)
+
+	_, err = LoadConfiguration([]byte(`oneof_policy: sometimes`))
+	assert.Error(err)
+}
+
+func TestLoadingSelectors(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+selectors:
+    - action: exclude
+      match:
+        kind: method
+        http: absent
+    - action: include
+      match:
+        streaming: unary
+        http_method: get
+`
+	result, err := LoadConfiguration([]byte(yml))
+	assert.NoError(err)
+	assert.Len(result.Selectors, 2)
+	assert.Equal(SelectorActionExclude, result.Selectors[0].Action)
+	assert.Equal(ElementKindMethod, result.Selectors[0].Match.Kind)
+	assert.Equal(HTTPAbsent, result.Selectors[0].Match.HTTP)
+	assert.Equal(SelectorActionInclude, result.Selectors[1].Action)
+	assert.Equal(StreamingUnary, result.Selectors[1].Match.Streaming)
+	assert.Equal("get", result.Selectors[1].Match.HTTPMethod)
+
+	_, err = LoadConfiguration([]byte(`
+selectors:
+    - action: exclude
+      match:
+        kind: field
+        streaming: unary
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`
+selectors:
+    - action: remove
+      match:
+        kind: method
+`))
+	assert.Error(err)
+}
+
+func TestLoadingTypeSelectors(t *testing.T) {
+	assert := require.New(t)
+
+	yml := `
+selectors:
+    - action: exclude
+      match:
+        type: acme.auth.Credentials
+    - action: exclude
+      match:
+        type_kind: scalar
+        label: repeated
+`
+	result, err := LoadConfiguration([]byte(yml))
+	assert.NoError(err)
+	assert.Len(result.Selectors, 2)
+	assert.Equal("acme.auth.Credentials", result.Selectors[0].Match.Type)
+	assert.Equal(TypeKindScalar, result.Selectors[1].Match.TypeKind)
+	assert.Equal(LabelRepeated, result.Selectors[1].Match.Label)
+
+	_, err = LoadConfiguration([]byte(`
+selectors:
+    - action: exclude
+      match:
+        kind: method
+        type: bytes
+`))
+	assert.Error(err)
+}
+
+func TestLoadingExternal(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(``))
+	assert.NoError(err)
+	assert.True(result.External.IsExternal("google/protobuf/timestamp.proto", "google.protobuf"))
+	assert.False(result.External.IsExternal("test.proto", "acme"))
+
+	result, err = LoadConfiguration([]byte(`---
+external:
+  files:
+    - vendor/*
+  packages:
+    - google.*
+`))
+	assert.NoError(err)
+	assert.True(result.External.IsExternal("vendor/b.proto", "vendor"))
+	assert.True(result.External.IsExternal("google/api/http.proto", "google.api"))
+	assert.False(result.External.IsExternal("test.proto", "acme"))
+
+	result, err = LoadConfiguration([]byte(`---
+external:
+  files:
+    - vendor/*
+`))
+	assert.NoError(err)
+	assert.True(result.External.IsExternal("vendor/b.proto", "vendor"))
+	assert.True(result.External.IsExternal("google/protobuf/timestamp.proto", "google.protobuf"))
+
+	result, err = LoadConfiguration([]byte(`---
+external:
+  filter_well_known_types: true
+`))
+	assert.NoError(err)
+	assert.False(result.External.IsExternal("google/protobuf/timestamp.proto", "google.protobuf"))
+
+	_, err = LoadConfiguration([]byte(`---
+external:
+  files:
+    - "["
+`))
+	assert.Error(err)
+}
+
+func TestLoadingOrdering(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(``))
+	assert.NoError(err)
+	assert.Equal(OrderingInput, result.Ordering)
+
+	result, err = LoadConfiguration([]byte(`ordering: alphabetical`))
+	assert.NoError(err)
+	assert.Equal(OrderingAlphabetical, result.Ordering)
+
+	_, err = LoadConfiguration([]byte(`ordering: random`))
+	assert.Error(err)
+}
+
+func TestLoadingSubstitutions(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(`---
+substitutions:
+  - match:
+      path: test.proto/msg_a/internal_metadata
+    type: bytes
+`))
+	assert.NoError(err)
+	assert.Len(result.Substitutions, 1)
+	assert.Equal(SubstituteBytes, result.Substitutions[0].Type)
+
+	_, err = LoadConfiguration([]byte(`---
+substitutions:
+  - match:
+      kind: method
+    type: bytes
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+substitutions:
+  - match:
+      name: internal_metadata
+`))
+	assert.Error(err)
+}
+
+func TestLoadingLayout(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(``))
+	assert.NoError(err)
+	assert.Equal(LayoutFiles, result.Layout.Mode)
+
+	result, err = LoadConfiguration([]byte(`---
+layout:
+  mode: bundle
+  bundle: public/api.proto
+`))
+	assert.NoError(err)
+	assert.Equal(LayoutBundle, result.Layout.Mode)
+	assert.Equal("public/api.proto", result.Layout.Bundle)
+
+	result, err = LoadConfiguration([]byte(`---
+layout:
+  mode: bundle
+`))
+	assert.NoError(err)
+	assert.Equal(DefaultBundlePath, result.Layout.Bundle)
+
+	_, err = LoadConfiguration([]byte(`---
+layout:
+  mode: random
+`))
+	assert.Error(err)
+}
+
+func TestLoadingOptionRules(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      kind: field
+      name: legacy_*
+    strip:
+      - (acme.owner_team)
+    set:
+      deprecated: true
+      (acme.visibility): public
+`))
+	assert.NoError(err)
+	assert.Len(result.OptionRules, 1)
+	rule := result.OptionRules[0]
+	assert.Equal(ElementKindField, rule.Match.Kind)
+	assert.True(rule.Strips("acme.owner_team"))
+	assert.False(rule.Strips("deprecated"))
+	assert.Equal(map[string]interface{}{
+		"deprecated":      true,
+		"acme.visibility": "public",
+	}, rule.GetValues())
+
+	_, err = LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      kind: field
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      kind: unknown
+    strip:
+      - deprecated
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      kind: field
+    set:
+      deprecatd: true
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      kind: message
+    set:
+      packed: true
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+option_rules:
+  - match:
+      name: legacy_*
+    set:
+      packed: true
+`))
+	assert.NoError(err)
+}
+
+func TestLoadingComments(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(`---
+comments:
+  strip_detached: true
+  transforms:
+    - drop_paragraph: "INTERNAL:"
+    - replace: '\w+\.corp\.acme\.com'
+      with: "[host]"
+`))
+	assert.NoError(err)
+	assert.False(result.Comments.Strip)
+	assert.True(result.Comments.StripDetached)
+	assert.Len(result.Comments.Transforms, 2)
+	assert.Equal(`\w+\.corp\.acme\.com`, result.Comments.Transforms[1].Replace)
+	assert.Equal("[host]", result.Comments.Transforms[1].With)
+
+	_, err = LoadConfiguration([]byte(`---
+comments:
+  transforms:
+    - drop_line: "TODO"
+      replace: "TODO"
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+comments:
+  transforms:
+    - drop_line: "("
+`))
+	assert.Error(err)
+}
+
+func TestLoadingRenames(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(`---
+renames:
+  - match:
+      path: test.proto/msg_a/internal_id
+    to: id
+  - match:
+      kind: message
+    regex: '^Internal(\w+)$'
+    replacement: '${1}'
+`))
+	assert.NoError(err)
+	assert.Len(result.Renames, 2)
+	assert.Equal("id", result.Renames[0].To)
+	assert.Equal(`^Internal(\w+)$`, result.Renames[1].Regex)
+
+	_, err = LoadConfiguration([]byte(`---
+renames:
+  - match:
+      kind: message
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+renames:
+  - match:
+      kind: file
+    to: other
+`))
+	assert.Error(err)
+
+	_, err = LoadConfiguration([]byte(`---
+renames:
+  - match:
+      kind: field
+    to: public-id
+`))
+	assert.Error(err)
+}
+
+func TestLoadingHoisting(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(``))
+	assert.NoError(err)
+	assert.False(result.Hoisting.Enabled)
+
+	result, err = LoadConfiguration([]byte(`---
+hoisting:
+  enabled: true
+  file: public.proto
+`))
+	assert.NoError(err)
+	assert.True(result.Hoisting.Enabled)
+	assert.Equal("public.proto", result.Hoisting.File)
+
+	_, err = LoadConfiguration([]byte(`---
+hoisting:
+  file: public.proto
+`))
+	assert.Error(err)
+}
+
+func TestLoadingDeprecations(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := LoadConfiguration([]byte(`---
+deprecations:
+  - match:
+      path: test.proto/msg_a/field_a_2
+    notice: "Deprecated: will be removed after 2027-01"
+  - match:
+      kind: method
+      name: Legacy*
+`))
+	assert.NoError(err)
+	assert.Len(result.Deprecations, 2)
+	assert.Equal("Deprecated: will be removed after 2027-01", result.Deprecations[0].Notice)
+	assert.Equal("", result.Deprecations[1].Notice)
+
+	_, err = LoadConfiguration([]byte(`---
+deprecations:
+  - match:
+      kind: oneof
+`))
+	assert.Error(err)
+}
@@ -0,0 +1,101 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// optionsTypes are the options messages of each kind of element
+var optionsTypes = map[ElementKind]reflect.Type{
+	ElementKindFile:      reflect.TypeOf(dpb.FileOptions{}),
+	ElementKindMessage:   reflect.TypeOf(dpb.MessageOptions{}),
+	ElementKindField:     reflect.TypeOf(dpb.FieldOptions{}),
+	ElementKindExtension: reflect.TypeOf(dpb.FieldOptions{}),
+	ElementKindOneOf:     reflect.TypeOf(dpb.OneofOptions{}),
+	ElementKindEnum:      reflect.TypeOf(dpb.EnumOptions{}),
+	ElementKindEnumValue: reflect.TypeOf(dpb.EnumValueOptions{}),
+	ElementKindService:   reflect.TypeOf(dpb.ServiceOptions{}),
+	ElementKindMethod:    reflect.TypeOf(dpb.MethodOptions{}),
+}
+
+// IsCustomOption returns true if an option is a custom option, named by its fully qualified name, standard options
+// never contain a dot
+func IsCustomOption(name string) bool {
+	return strings.Contains(normalizeOptionName(name), ".")
+}
+
+func hasStandardOption(optionsType reflect.Type, name string) bool {
+	for _, property := range proto.GetProperties(optionsType).Prop {
+		if property.OrigName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isStandardOption returns true if a standard option exists for a kind of element, or for any kind if it's empty
+func isStandardOption(kind ElementKind, name string) bool {
+	if optionsType, found := optionsTypes[kind]; found {
+		return hasStandardOption(optionsType, name)
+	}
+	for _, optionsType := range optionsTypes {
+		if hasStandardOption(optionsType, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// OptionRule rewrite the options of the elements matched by a selector, after the options filter is applied. Options
+// are named like in the options filter: standard options by their field name (deprecated, go_package, ...) and custom
+// options by their fully qualified name with or without parentheses ((acme.owner_team)).
+type OptionRule struct {
+	Match Selector `yaml:"match"`
+	// Strip is a list of options removed from the elements, Glob patterns can be used
+	Strip []string `yaml:"strip"`
+	// Set are the values of options set on the elements, options that don't exist for an element are ignored
+	Set map[string]interface{} `yaml:"set"`
+}
+
+// Strips returns true if the rule remove an option
+func (r *OptionRule) Strips(name string) bool {
+	return matchesAnyOption(r.Strip, normalizeOptionName(name))
+}
+
+// GetValues returns the values set by the rule, by normalized option name
+func (r *OptionRule) GetValues() map[string]interface{} {
+	result := map[string]interface{}{}
+	for name, value := range r.Set {
+		result[normalizeOptionName(name)] = value
+	}
+	return result
+}
+
+func (r *OptionRule) Validate() error {
+	if len(r.Strip) == 0 && len(r.Set) == 0 {
+		return fmt.Errorf("An option rule need options to strip or set")
+	}
+
+	for _, pattern := range r.Strip {
+		if _, err := path.Match(normalizeOptionName(pattern), ""); err != nil {
+			return fmt.Errorf("Invalid option pattern '%s': %w", pattern, err)
+		}
+	}
+
+	for name := range r.Set {
+		normalized := normalizeOptionName(name)
+		if normalized == "" {
+			return fmt.Errorf("An option set by a rule need a name")
+		}
+		if !IsCustomOption(normalized) && !isStandardOption(r.Match.Kind, normalized) {
+			return fmt.Errorf("Unknown option %s", name)
+		}
+	}
+
+	return r.Match.Validate()
+}
@@ -0,0 +1,50 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// OptionsFilter control which options are copied to the output. Standard options are named by their field name
+// (deprecated, java_package, ...) and custom options by their fully qualified name with or without parentheses
+// ((acme.owner_team)). Glob patterns can be used.
+type OptionsFilter struct {
+	// Allow, when not empty, is the list of the only options that are copied
+	Allow []string `yaml:"allow"`
+	// Deny is a list of options that are never copied
+	Deny []string `yaml:"deny"`
+}
+
+func normalizeOptionName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "("), ")")
+}
+
+func matchesAnyOption(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(normalizeOptionName(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowed returns true if the option should be copied to the output
+func (f *OptionsFilter) IsAllowed(name string) bool {
+	name = normalizeOptionName(name)
+
+	if len(f.Allow) > 0 && !matchesAnyOption(f.Allow, name) {
+		return false
+	}
+
+	return !matchesAnyOption(f.Deny, name)
+}
+
+func (f *OptionsFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Allow...), f.Deny...) {
+		if _, err := path.Match(normalizeOptionName(pattern), ""); err != nil {
+			return fmt.Errorf("Invalid option pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// PackageRename rename a package in the output, sub-packages are renamed too (Renaming `acme.internal` to `acme`
+// renames `acme.internal.search.v1` to `acme.search.v1`).
+//
+// Options are file options (go_package, java_package, csharp_namespace, ...) set on the renamed files, their values
+// are text/template templates executed with a PackageTemplateData.
+type PackageRename struct {
+	From    string            `yaml:"from"`
+	To      string            `yaml:"to"`
+	Options map[string]string `yaml:"options"`
+}
+
+// PackageTemplateData is available to the templates of the options of a package rename
+type PackageTemplateData struct {
+	// Package is the new package (acme.search.v1)
+	Package string
+	// PackagePath is the new package as a path (acme/search/v1)
+	PackagePath string
+	// PackageName is the last part of the new package (v1)
+	PackageName string
+	// PascalPackage is the new package with every part in pascal case (Acme.Search.V1)
+	PascalPackage string
+	// File is the name of the output file
+	File string
+}
+
+// NewPackageTemplateData create the data available to option templates for a file
+func NewPackageTemplateData(packageName string, fileName string) PackageTemplateData {
+	parts := strings.Split(packageName, ".")
+	pascalParts := make([]string, len(parts))
+	for i, part := range parts {
+		pascalParts[i] = toPascalCase(part)
+	}
+
+	return PackageTemplateData{
+		Package:       packageName,
+		PackagePath:   strings.Join(parts, "/"),
+		PackageName:   parts[len(parts)-1],
+		PascalPackage: strings.Join(pascalParts, "."),
+		File:          fileName,
+	}
+}
+
+func toPascalCase(name string) string {
+	var result strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if word != "" {
+			result.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return result.String()
+}
+
+// Rename returns the new name of a package and true if the rule applies to it
+func (r *PackageRename) Rename(packageName string) (string, bool) {
+	if packageName == r.From {
+		return r.To, true
+	}
+
+	if strings.HasPrefix(packageName, r.From+".") {
+		suffix := strings.TrimPrefix(packageName, r.From)
+		if r.To == "" {
+			return strings.TrimPrefix(suffix, "."), true
+		}
+		return r.To + suffix, true
+	}
+
+	return packageName, false
+}
+
+// RenderOptions returns the values of the options for a file
+func (r *PackageRename) RenderOptions(data PackageTemplateData) (map[string]string, error) {
+	result := map[string]string{}
+	for name, text := range r.Options {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template for option %s: %w", name, err)
+		}
+
+		var value strings.Builder
+		if err := tmpl.Execute(&value, data); err != nil {
+			return nil, fmt.Errorf("Failed to render option %s: %w", name, err)
+		}
+		result[name] = value.String()
+	}
+	return result, nil
+}
+
+func (r *PackageRename) Validate() error {
+	if r.From == "" {
+		return fmt.Errorf("A package rename need a 'from' package")
+	}
+
+	for name, text := range r.Options {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("Invalid template for option %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// FindPackageRename returns the first package rename applying to a package or nil if the package isn't renamed
+func (config *Configuration) FindPackageRename(packageName string) *PackageRename {
+	for _, rename := range config.Packages {
+		if _, applies := rename.Rename(packageName); applies {
+			return rename
+		}
+	}
+	return nil
+}
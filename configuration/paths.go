@@ -0,0 +1,102 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PathRewrite change the path of output files, exactly one of Prefix, Regex or Flatten need to be set:
+//
+// * Prefix replace a prefix of the path by Replacement.
+// * Regex replace the matches of a regular expression by Replacement, that can reference capture groups ($1, ${name}).
+// * Flatten move every file directly in a directory, keeping only their base name.
+type PathRewrite struct {
+	Prefix      string `yaml:"prefix"`
+	Regex       string `yaml:"regex"`
+	Flatten     string `yaml:"flatten"`
+	Replacement string `yaml:"replacement"`
+
+	regex *regexp.Regexp
+}
+
+// getRegex returns the compiled regular expression of the rule, it's only compiled once
+func (r *PathRewrite) getRegex() (*regexp.Regexp, error) {
+	if r.regex == nil {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path regex '%s': %w", r.Regex, err)
+		}
+		r.regex = regex
+	}
+	return r.regex, nil
+}
+
+// hasPrefix returns true if the path starts with the prefix of the rule, the prefix need to end on a directory
+// boundary so that "api" doesn't match "apiv2/search.proto"
+func (r *PathRewrite) hasPrefix(filePath string) bool {
+	if !strings.HasPrefix(filePath, r.Prefix) {
+		return false
+	}
+	rest := strings.TrimPrefix(filePath, r.Prefix)
+	return rest == "" || strings.HasSuffix(r.Prefix, "/") || strings.HasPrefix(rest, "/")
+}
+
+// Rewrite returns the new path of a file and true if the rule applies to it
+func (r *PathRewrite) Rewrite(filePath string) (string, bool, error) {
+	switch {
+	case r.Prefix != "":
+		if !r.hasPrefix(filePath) {
+			return filePath, false, nil
+		}
+		return r.Replacement + strings.TrimPrefix(filePath, r.Prefix), true, nil
+
+	case r.Regex != "":
+		regex, err := r.getRegex()
+		if err != nil {
+			return filePath, false, err
+		}
+		if !regex.MatchString(filePath) {
+			return filePath, false, nil
+		}
+		return regex.ReplaceAllString(filePath, r.Replacement), true, nil
+
+	default:
+		return path.Join(r.Flatten, path.Base(filePath)), true, nil
+	}
+}
+
+func (r *PathRewrite) Validate() error {
+	set := 0
+	for _, value := range []string{r.Prefix, r.Regex, r.Flatten} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("A path rewrite need exactly one of prefix, regex or flatten")
+	}
+
+	if r.Regex != "" {
+		if _, err := r.getRegex(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RewritePath returns the path of a file in the output, using the first path rewrite that applies to it
+func (config *Configuration) RewritePath(filePath string) (string, error) {
+	for _, rewrite := range config.Paths {
+		result, applies, err := rewrite.Rewrite(filePath)
+		if err != nil {
+			return "", err
+		}
+		if applies {
+			return result, nil
+		}
+	}
+	return filePath, nil
+}
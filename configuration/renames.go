@@ -0,0 +1,78 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RenameRule rename the elements matched by a selector in the output, references to them are updated. Exactly one of
+// To or Regex need to be set:
+//
+// * To is the new name of the elements.
+// * Regex replace the matches of a regular expression in the names by Replacement, that can reference capture groups
+// ($1, ${name}).
+type RenameRule struct {
+	Match       Selector `yaml:"match"`
+	To          string   `yaml:"to"`
+	Regex       string   `yaml:"regex"`
+	Replacement string   `yaml:"replacement"`
+
+	regex *regexp.Regexp
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// getRegex returns the compiled regular expression of the rule, it's only compiled once
+func (r *RenameRule) getRegex() (*regexp.Regexp, error) {
+	if r.regex == nil {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid rename regex '%s': %w", r.Regex, err)
+		}
+		r.regex = regex
+	}
+	return r.regex, nil
+}
+
+// Rename returns the new name of an element matched by the rule, names that aren't valid protobuf identifiers are
+// errors
+func (r *RenameRule) Rename(name string) (string, error) {
+	result := r.To
+	if result == "" {
+		regex, err := r.getRegex()
+		if err != nil {
+			return "", err
+		}
+		result = regex.ReplaceAllString(name, r.Replacement)
+	}
+
+	if !identifierRegex.MatchString(result) {
+		return "", fmt.Errorf("Renaming %s gives '%s' that isn't a valid identifier", name, result)
+	}
+	return result, nil
+}
+
+func (r *RenameRule) Validate() error {
+	if (r.To == "") == (r.Regex == "") {
+		return fmt.Errorf("A rename need exactly one of to or regex")
+	}
+
+	if r.To != "" && !identifierRegex.MatchString(r.To) {
+		return fmt.Errorf("Invalid rename target '%s', it isn't a valid identifier", r.To)
+	}
+
+	if r.Regex != "" {
+		if _, err := r.getRegex(); err != nil {
+			return err
+		}
+	}
+
+	switch r.Match.Kind {
+	case "", ElementKindMessage, ElementKindField, ElementKindEnum, ElementKindEnumValue, ElementKindService,
+		ElementKindMethod:
+	default:
+		return fmt.Errorf("Renames can't match %s", r.Match.Kind)
+	}
+
+	return r.Match.Validate()
+}
@@ -0,0 +1,196 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+)
+
+// ElementKind is the kind of protobuf element a selector can match
+type ElementKind string
+
+const (
+	ElementKindFile      ElementKind = "file"
+	ElementKindMessage   ElementKind = "message"
+	ElementKindField     ElementKind = "field"
+	ElementKindExtension ElementKind = "extension"
+	ElementKindOneOf     ElementKind = "oneof"
+	ElementKindEnum      ElementKind = "enum"
+	ElementKindEnumValue ElementKind = "enum_value"
+	ElementKindService   ElementKind = "service"
+	ElementKindMethod    ElementKind = "method"
+)
+
+func (k ElementKind) IsValid() bool {
+	switch k {
+	case ElementKindFile, ElementKindMessage, ElementKindField, ElementKindExtension, ElementKindOneOf, ElementKindEnum,
+		ElementKindEnumValue, ElementKindService, ElementKindMethod:
+		return true
+	}
+	return false
+}
+
+// Streaming kinds of service methods
+const (
+	StreamingUnary  = "unary"
+	StreamingClient = "client"
+	StreamingServer = "server"
+	StreamingBidi   = "bidi"
+)
+
+// Values for the presence of the HTTP annotation on service methods
+const (
+	HTTPPresent = "present"
+	HTTPAbsent  = "absent"
+)
+
+// Kinds of field types
+const (
+	TypeKindMessage = "message"
+	TypeKindEnum    = "enum"
+	TypeKindScalar  = "scalar"
+)
+
+// Labels of fields, maps are considered separately from repeated fields
+const (
+	LabelOptional = "optional"
+	LabelRequired = "required"
+	LabelRepeated = "repeated"
+	LabelMap      = "map"
+)
+
+// Selector match elements by their properties instead of their position in the filter tree.
+//
+// Every property that is set need to match for the selector to match. Name and Path are glob patterns (See
+// path.Match), Path being matched against the slash separated path of the element (`file.proto/Message/field`).
+type Selector struct {
+	Kind ElementKind `yaml:"kind"`
+	Name string      `yaml:"name"`
+	Path string      `yaml:"path"`
+
+	// Streaming match service methods by their streaming kind: unary, client, server or bidi
+	Streaming string `yaml:"streaming"`
+	// HTTP match service methods on the presence of a `google.api.http` annotation: present or absent
+	HTTP string `yaml:"http"`
+	// HTTPMethod match service methods on the method of their `google.api.http` annotation (get, post, ...)
+	HTTPMethod string `yaml:"http_method"`
+	// HTTPPath match service methods on the path of their `google.api.http` annotation (Glob pattern)
+	HTTPPath string `yaml:"http_path"`
+
+	// Type match fields by their type, either a scalar type name (bytes, int32, ...) or the fully qualified name of a
+	// message or enum (Glob pattern). For map fields the value type is matched.
+	Type string `yaml:"type"`
+	// TypeKind match fields by the kind of their type: message, enum or scalar
+	TypeKind string `yaml:"type_kind"`
+	// Label match fields by their label: optional, required, repeated or map
+	Label string `yaml:"label"`
+	// MapKeyType match map fields by the type of their keys (Glob pattern)
+	MapKeyType string `yaml:"map_key_type"`
+	// MapValueType match map fields by the type of their values (Glob pattern)
+	MapValueType string `yaml:"map_value_type"`
+
+	// Extendee match extensions by the fully qualified name of the message they extend (Glob pattern)
+	Extendee string `yaml:"extendee"`
+}
+
+// IsFieldOnly returns true if the selector uses properties that only fields (And extensions) have
+func (s *Selector) IsFieldOnly() bool {
+	return s.Type != "" || s.TypeKind != "" || s.Label != "" || s.MapKeyType != "" || s.MapValueType != "" ||
+		s.Extendee != ""
+}
+
+// IsMethodOnly returns true if the selector uses properties that only service methods have
+func (s *Selector) IsMethodOnly() bool {
+	return s.Streaming != "" || s.HTTP != "" || s.HTTPMethod != "" || s.HTTPPath != ""
+}
+
+func validateGlob(name string, pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("Invalid %s pattern '%s': %w", name, pattern, err)
+	}
+	return nil
+}
+
+func (s *Selector) Validate() error {
+	if s.Kind != "" && !s.Kind.IsValid() {
+		return fmt.Errorf("Unknown element kind: %s", s.Kind)
+	}
+
+	if s.IsMethodOnly() && s.Kind != "" && s.Kind != ElementKindMethod {
+		return fmt.Errorf("Selectors on streaming or HTTP annotations can only match methods, not %s", s.Kind)
+	}
+
+	if s.IsFieldOnly() && s.Kind != "" && s.Kind != ElementKindField && s.Kind != ElementKindExtension {
+		return fmt.Errorf("Selectors on types or labels can only match fields or extensions, not %s", s.Kind)
+	}
+
+	if s.Extendee != "" && s.Kind == ElementKindField {
+		return fmt.Errorf("Selectors on extendee can only match extensions")
+	}
+
+	if s.IsFieldOnly() && s.IsMethodOnly() {
+		return fmt.Errorf("A selector can't match both fields and methods")
+	}
+
+	switch s.TypeKind {
+	case "", TypeKindMessage, TypeKindEnum, TypeKindScalar:
+	default:
+		return fmt.Errorf("Unknown type kind: %s", s.TypeKind)
+	}
+
+	switch s.Label {
+	case "", LabelOptional, LabelRequired, LabelRepeated, LabelMap:
+	default:
+		return fmt.Errorf("Unknown label: %s", s.Label)
+	}
+
+	switch s.Streaming {
+	case "", StreamingUnary, StreamingClient, StreamingServer, StreamingBidi:
+	default:
+		return fmt.Errorf("Unknown streaming kind: %s", s.Streaming)
+	}
+
+	switch s.HTTP {
+	case "", HTTPPresent, HTTPAbsent:
+	default:
+		return fmt.Errorf("Unknown http value: %s", s.HTTP)
+	}
+
+	patterns := map[string]string{
+		"name":           s.Name,
+		"path":           s.Path,
+		"http_path":      s.HTTPPath,
+		"type":           s.Type,
+		"map_key_type":   s.MapKeyType,
+		"map_value_type": s.MapValueType,
+		"extendee":       s.Extendee,
+	}
+	for name, pattern := range patterns {
+		if err := validateGlob(name, pattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SelectorAction is what happens to the elements matched by a selector
+type SelectorAction string
+
+const (
+	SelectorActionInclude SelectorAction = "include"
+	SelectorActionExclude SelectorAction = "exclude"
+)
+
+// SelectorRule include or exclude every element matched by a selector, as if they were all listed in the filter tree
+type SelectorRule struct {
+	Action SelectorAction `yaml:"action"`
+	Match  Selector       `yaml:"match"`
+}
+
+func (r *SelectorRule) Validate() error {
+	if r.Action != SelectorActionInclude && r.Action != SelectorActionExclude {
+		return fmt.Errorf("Unknown selector action: '%s'", r.Action)
+	}
+
+	return r.Match.Validate()
+}
@@ -0,0 +1,30 @@
+package configuration
+
+import "fmt"
+
+// SubstituteBytes is the type used to replace a field type by `bytes`
+const SubstituteBytes = "bytes"
+
+// TypeSubstitution replace the type of the fields matched by a selector, keeping them on the wire while hiding their
+// structure. Type is either `bytes` or the fully qualified name of a message (google.protobuf.Any,
+// google.protobuf.Empty, acme.Opaque, ...).
+type TypeSubstitution struct {
+	Match Selector `yaml:"match"`
+	Type  string   `yaml:"type"`
+}
+
+func (s *TypeSubstitution) Validate() error {
+	if s.Type == "" {
+		return fmt.Errorf("A type substitution need a type")
+	}
+
+	if s.Match.Kind != "" && s.Match.Kind != ElementKindField {
+		return fmt.Errorf("Type substitutions can only match fields, not %s", s.Match.Kind)
+	}
+
+	if s.Match.IsMethodOnly() {
+		return fmt.Errorf("Type substitutions can only match fields")
+	}
+
+	return s.Match.Validate()
+}
@@ -0,0 +1,246 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Variables are the values available to `${name}` substitutions and `when` conditions in a configuration
+type Variables map[string]string
+
+var variableReference = regexp.MustCompile(`\$\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}`)
+
+func (vars Variables) get(name string) (string, error) {
+	value, found := vars[name]
+	if !found {
+		return "", fmt.Errorf("Undefined variable '%s'", name)
+	}
+	return value, nil
+}
+
+// expand replaces every `${name}` reference in the text by the value of the variable
+func (vars Variables) expand(text string) (string, error) {
+	var firstErr error
+	result := variableReference.ReplaceAllStringFunc(text, func(match string) string {
+		name := variableReference.FindStringSubmatch(match)[1]
+		value, err := vars.get(name)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+
+	return result, firstErr
+}
+
+// mergeVariables create the variables visible to a configuration, values supplied by the caller take precedence
+// over the defaults declared in the configuration itself
+func mergeVariables(defaults map[string]string, supplied Variables) Variables {
+	result := Variables{}
+	for name, value := range defaults {
+		result[name] = value
+	}
+	for name, value := range supplied {
+		result[name] = value
+	}
+	return result
+}
+
+type conditionTokenType int
+
+const (
+	conditionTokenIdentifier conditionTokenType = iota
+	conditionTokenString
+	conditionTokenOperator
+	conditionTokenEnd
+)
+
+type conditionToken struct {
+	tokenType conditionTokenType
+	value     string
+}
+
+func tokenizeCondition(condition string) ([]conditionToken, error) {
+	result := []conditionToken{}
+	runes := []rune(condition)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string in condition '%s'", condition)
+			}
+			result = append(result, conditionToken{conditionTokenString, string(runes[i+1 : end])})
+			i = end + 1
+
+		case r == '_' || unicode.IsLetter(r):
+			end := i + 1
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			result = append(result, conditionToken{conditionTokenIdentifier, string(runes[i:end])})
+			i = end
+
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "(", ")"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("Unexpected character '%c' in condition '%s'", r, condition)
+			}
+			result = append(result, conditionToken{conditionTokenOperator, operator})
+			i += len(operator)
+		}
+	}
+
+	return append(result, conditionToken{tokenType: conditionTokenEnd}), nil
+}
+
+// conditionParser is a recursive descent evaluator for conditions like `partner == "acme" && !internal`
+type conditionParser struct {
+	condition string
+	tokens    []conditionToken
+	position  int
+	variables Variables
+}
+
+func (p *conditionParser) peek() conditionToken {
+	return p.tokens[p.position]
+}
+
+func (p *conditionParser) isOperator(operator string) bool {
+	token := p.peek()
+	return token.tokenType == conditionTokenOperator && token.value == operator
+}
+
+func (p *conditionParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+
+	for p.isOperator("||") {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+
+	return result, nil
+}
+
+func (p *conditionParser) parseAnd() (bool, error) {
+	result, err := p.parseUnary()
+	if err != nil {
+		return false, err
+	}
+
+	for p.isOperator("&&") {
+		p.position++
+		right, err := p.parseUnary()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+
+	return result, nil
+}
+
+func (p *conditionParser) parseUnary() (bool, error) {
+	if p.isOperator("!") {
+		p.position++
+		value, err := p.parseUnary()
+		return !value, err
+	}
+
+	if p.isOperator("(") {
+		p.position++
+		value, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if !p.isOperator(")") {
+			return false, fmt.Errorf("Expected ')' in condition '%s'", p.condition)
+		}
+		p.position++
+		return value, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseOperand() (string, bool, error) {
+	token := p.peek()
+	switch token.tokenType {
+	case conditionTokenIdentifier:
+		p.position++
+		value, err := p.variables.get(token.value)
+		return value, true, err
+	case conditionTokenString:
+		p.position++
+		return token.value, false, nil
+	default:
+		return "", false, fmt.Errorf("Expected a variable or a string in condition '%s'", p.condition)
+	}
+}
+
+func (p *conditionParser) parseComparison() (bool, error) {
+	left, isVariable, err := p.parseOperand()
+	if err != nil {
+		return false, err
+	}
+
+	if p.isOperator("==") || p.isOperator("!=") {
+		operator := p.peek().value
+		p.position++
+		right, _, err := p.parseOperand()
+		if err != nil {
+			return false, err
+		}
+		return (left == right) == (operator == "=="), nil
+	}
+
+	if !isVariable {
+		return false, fmt.Errorf("A string can't be used as a condition in '%s'", p.condition)
+	}
+
+	// A variable alone is true when it's set to anything else than an empty string or "false"
+	return left != "" && left != "false", nil
+}
+
+// evaluateCondition evaluate a `when` condition against the variables
+func evaluateCondition(condition string, variables Variables) (bool, error) {
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return false, err
+	}
+
+	parser := conditionParser{condition: condition, tokens: tokens, variables: variables}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+
+	if parser.peek().tokenType != conditionTokenEnd {
+		return false, fmt.Errorf("Unexpected '%s' in condition '%s'", parser.peek().value, condition)
+	}
+
+	return result, nil
+}
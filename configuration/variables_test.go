@@ -0,0 +1,43 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	assert := require.New(t)
+
+	variables := Variables{"partner": "acme", "internal": "false", "beta": "true"}
+
+	cases := map[string]bool{
+		`partner == "acme"`:                       true,
+		`partner == 'globex'`:                     false,
+		`partner != "acme"`:                       false,
+		`beta`:                                    true,
+		`internal`:                                false,
+		`!internal`:                               true,
+		`beta && partner == "acme"`:               true,
+		`internal || partner == "globex"`:         false,
+		`!(internal || partner == "globex")`:      true,
+		`partner == "acme" && (beta || internal)`: true,
+	}
+
+	for condition, expected := range cases {
+		actual, err := evaluateCondition(condition, variables)
+		assert.NoError(err, condition)
+		assert.Equal(expected, actual, condition)
+	}
+}
+
+func TestEvaluateConditionErrors(t *testing.T) {
+	assert := require.New(t)
+
+	variables := Variables{"partner": "acme"}
+
+	for _, condition := range []string{`unknown == "x"`, `partner ==`, `"acme"`, `(partner`, `partner "acme"`, `partner == "acme`} {
+		_, err := evaluateCondition(condition, variables)
+		assert.Error(err, condition)
+	}
+}
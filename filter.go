@@ -2,21 +2,48 @@ package protofilter
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/builder"
 	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/builderutil"
 	"github.com/vbfox/proto-filter/internal/included"
+	"github.com/vbfox/proto-filter/internal/optionutil"
+	"github.com/vbfox/proto-filter/internal/selector"
+	"github.com/vbfox/proto-filter/report"
 )
 
 type filteringState struct {
-	descriptors     []*desc.FileDescriptor
-	config          *configuration.Configuration
-	fileBuilders    map[string]*builder.FileBuilder
+	descriptors []*desc.FileDescriptor
+	config      *configuration.Configuration
+	// fileBuilders contains for each input file the output files where its elements are placed
+	fileBuilders    map[string][]*builder.FileBuilder
 	messageBuilders map[string]*builder.MessageBuilder
 	enumBuilders    map[string]*builder.EnumBuilder
 	serviceBuilders map[string]*builder.ServiceBuilder
 	included        map[string]bool
+	// containers contains the messages only included to contain referenced types
+	containers map[string]bool
+	// hoisted contains the types moved out of their containers when hoisting is enabled
+	hoisted []hoistedType
+	report  *report.Report
+	// optionDependencies contains for each input file the files defining the custom options it uses
+	optionDependencies map[string]map[string]*desc.FileDescriptor
+	// detachedComments contains the leading detached comments of the elements, they are lost by the builders and need
+	// to be restored on the built descriptors
+	detachedComments map[builder.Builder][]string
+	// publicDependencies contains for each output file the public imports that are kept
+	publicDependencies map[*builder.FileBuilder][]string
+	// outputFiles contains the output files by path
+	outputFiles map[string]*builder.FileBuilder
+	// outputInputs contains for each output file the input files placed in it
+	outputInputs map[*builder.FileBuilder][]*desc.FileDescriptor
+	// symbolOrigins contains for each output file the input file of each of its top level elements
+	symbolOrigins map[*builder.FileBuilder]map[string]string
+	// renames contains the new names of the renamed elements by fully qualified name
+	renames map[string]string
 }
 
 func (s *filteringState) IsIncluded(descriptor desc.Descriptor) bool {
@@ -24,58 +51,311 @@ func (s *filteringState) IsIncluded(descriptor desc.Descriptor) bool {
 	return found && value
 }
 
+// setComments copy the comments of an element to its builder
+func (s *filteringState) setComments(target builder.Builder, descriptor desc.Descriptor) error {
+	comments := target.GetComments()
+	builderutil.SetComments(comments, descriptor.GetSourceInfo())
+	if err := s.transformComments(comments, descriptor.GetFullyQualifiedName()); err != nil {
+		return err
+	}
+	if len(comments.LeadingDetachedComments) > 0 {
+		s.detachedComments[target] = comments.LeadingDetachedComments
+	}
+	return nil
+}
+
+// transformComment apply the comment transforms of the configuration to a comment, reporting the redactions made
+func (s *filteringState) transformComment(comment string, element string) (string, error) {
+	result, redactions, err := s.config.Comments.Transform(comment)
+	if err != nil {
+		return "", fmt.Errorf("Failed to transform the comments of %s: %w", element, err)
+	}
+	for _, redaction := range redactions {
+		s.report.Add(report.Redaction, element, "%s", redaction)
+	}
+	return result, nil
+}
+
+// transformComments apply the comment transforms of the configuration to the comments of an element
+func (s *filteringState) transformComments(comments *builder.Comments, element string) error {
+	var err error
+	if comments.LeadingComment, err = s.transformComment(comments.LeadingComment, element); err != nil {
+		return err
+	}
+	if comments.TrailingComment, err = s.transformComment(comments.TrailingComment, element); err != nil {
+		return err
+	}
+
+	detached := comments.LeadingDetachedComments
+	comments.LeadingDetachedComments = nil
+	if s.config.Comments.StripDetached {
+		return nil
+	}
+	for _, comment := range detached {
+		transformed, err := s.transformComment(comment, element)
+		if err != nil {
+			return err
+		}
+		if transformed != "" {
+			comments.LeadingDetachedComments = append(comments.LeadingDetachedComments, transformed)
+		}
+	}
+	return nil
+}
+
+// restoreDetachedComments set the leading detached comments on the elements of a built file
+func (s *filteringState) restoreDetachedComments(descriptor *desc.FileDescriptor) {
+	for target, comments := range s.detachedComments {
+		element := descriptor.FindSymbol(builder.GetFullyQualifiedName(target))
+		if element == nil || element.GetSourceInfo() == nil {
+			continue
+		}
+		element.GetSourceInfo().LeadingDetachedComments = comments
+	}
+}
+
+// findDeprecation returns the first deprecation rule matching an element or nil if it isn't deprecated by the
+// configuration, only elements having a deprecated option can match
+func (s *filteringState) findDeprecation(descriptor desc.Descriptor) (*configuration.DeprecationRule, error) {
+	switch descriptor.(type) {
+	case *desc.MessageDescriptor, *desc.FieldDescriptor, *desc.EnumDescriptor, *desc.EnumValueDescriptor,
+		*desc.ServiceDescriptor, *desc.MethodDescriptor:
+	default:
+		return nil, nil
+	}
+
+	for _, rule := range s.config.Deprecations {
+		matches, err := selector.Matches(&rule.Match, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return rule, nil
+		}
+	}
+	return nil, nil
+}
+
+// prependNotice returns a comment starting with a deprecation notice, separated from the existing comment by an empty
+// line
+func prependNotice(notice string, comment string) string {
+	lines := strings.Split(strings.TrimRight(notice, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = " " + line
+		}
+	}
+	result := strings.Join(lines, "\n") + "\n"
+	if comment != "" {
+		result += "\n" + comment
+	}
+	return result
+}
+
+// getOptionRules returns the option rules matching an element, in the order of the configuration
+func (s *filteringState) getOptionRules(descriptor desc.Descriptor) ([]*configuration.OptionRule, error) {
+	result := []*configuration.OptionRule{}
+	for _, rule := range s.config.OptionRules {
+		matches, err := selector.Matches(&rule.Match, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			result = append(result, rule)
+		}
+	}
+	return result, nil
+}
+
+// copyOptions set the options of the element on its builder, only keeping the options allowed by the configuration,
+// applying the option rules matching the element and marking it as deprecated if a deprecation rule matches it
+func (s *filteringState) copyOptions(target builder.Builder, descriptor desc.Descriptor) error {
+	file := descriptor.GetFile()
+	rules, err := s.getOptionRules(descriptor)
+	if err != nil {
+		return fmt.Errorf("Failed to copy options of %s: %w", descriptor.GetFullyQualifiedName(), err)
+	}
+
+	keep := func(name string) bool {
+		for _, rule := range rules {
+			if rule.Strips(name) {
+				return false
+			}
+		}
+		return s.config.Options.IsAllowed(name)
+	}
+	options, extensions, err := optionutil.Filter(descriptor.GetOptions(), file, keep)
+	if err != nil {
+		return fmt.Errorf("Failed to copy options of %s: %w", descriptor.GetFullyQualifiedName(), err)
+	}
+
+	for _, rule := range rules {
+		if len(rule.Set) == 0 {
+			continue
+		}
+		if options == nil {
+			options = descriptor.GetOptions()
+		}
+		values := rule.GetValues()
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if configuration.IsCustomOption(name) && optionutil.FindExtension(file, name) == nil {
+				s.report.Add(report.Warning, descriptor.GetFullyQualifiedName(),
+					"Option %s set by an option rule isn't defined in %s or its imports", name, file.GetName())
+			}
+		}
+		var setExtensions []*desc.FieldDescriptor
+		options, setExtensions, err = optionutil.Set(options, file, values)
+		if err != nil {
+			return fmt.Errorf("Failed to set options of %s: %w", descriptor.GetFullyQualifiedName(), err)
+		}
+		extensions = append(extensions, setExtensions...)
+	}
+
+	deprecation, err := s.findDeprecation(descriptor)
+	if err != nil {
+		return fmt.Errorf("Failed to deprecate %s: %w", descriptor.GetFullyQualifiedName(), err)
+	}
+	if deprecation != nil {
+		if options == nil {
+			options = descriptor.GetOptions()
+		}
+		options, _, err = optionutil.Set(options, file, map[string]interface{}{"deprecated": true})
+		if err != nil {
+			return fmt.Errorf("Failed to deprecate %s: %w", descriptor.GetFullyQualifiedName(), err)
+		}
+		// Comments are always set before options, the notice is prepended to the transformed comment
+		if deprecation.Notice != "" {
+			comments := target.GetComments()
+			comments.LeadingComment = prependNotice(deprecation.Notice, comments.LeadingComment)
+		}
+	}
+
+	builderutil.SetOptions(target, options)
+
+	for _, extension := range extensions {
+		dependencies, found := s.optionDependencies[file.GetName()]
+		if !found {
+			dependencies = map[string]*desc.FileDescriptor{}
+			s.optionDependencies[file.GetName()] = dependencies
+		}
+		dependencies[extension.GetFile().GetName()] = extension.GetFile()
+	}
+
+	return nil
+}
+
+// addOptionDependencies import the files defining the custom options used in each output file
+func (s *filteringState) addOptionDependencies() {
+	for fileName, dependencies := range s.optionDependencies {
+		for _, fileBuilder := range s.fileBuilders[fileName] {
+			for dependencyName, dependency := range dependencies {
+				s.addDependency(fileBuilder, dependencyName, dependency)
+			}
+		}
+	}
+}
+
 func (s *filteringState) RunFilter() error {
 	err := s.Pass1()
 	if err != nil {
 		return err
 	}
 
-	return s.Pass2()
+	err = s.Pass2()
+	if err != nil {
+		return err
+	}
+
+	s.addOptionDependencies()
+	s.addPublicDependencies()
+
+	return nil
 }
 
 func initState(descriptors []*desc.FileDescriptor, config *configuration.Configuration) (*filteringState, error) {
-	included, err := included.BuildIncluded(descriptors, config)
+	report := report.New()
+	inclusions, err := included.BuildIncluded(descriptors, config, report)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("Included = %+v", included)
+	fmt.Printf("Included = %+v", inclusions.Included)
 
 	return &filteringState{
 		descriptors:     descriptors,
 		config:          config,
-		fileBuilders:    map[string]*builder.FileBuilder{},
+		fileBuilders:    map[string][]*builder.FileBuilder{},
 		messageBuilders: map[string]*builder.MessageBuilder{},
 		enumBuilders:    map[string]*builder.EnumBuilder{},
 		serviceBuilders: map[string]*builder.ServiceBuilder{},
-		included:        included,
+		included:        inclusions.Included,
+		containers:      inclusions.Containers,
+		report:          report,
+
+		optionDependencies: map[string]map[string]*desc.FileDescriptor{},
+		detachedComments:   map[builder.Builder][]string{},
+		publicDependencies: map[*builder.FileBuilder][]string{},
+		outputFiles:        map[string]*builder.FileBuilder{},
+		outputInputs:       map[*builder.FileBuilder][]*desc.FileDescriptor{},
+		symbolOrigins:      map[*builder.FileBuilder]map[string]string{},
+		renames:            map[string]string{},
 	}, nil
 }
 
 func (s *filteringState) GetDescriptors() ([]*desc.FileDescriptor, error) {
 	result := []*desc.FileDescriptor{}
+	built := map[*builder.FileBuilder]bool{}
 
-	for _, builder := range s.fileBuilders {
-		descriptor, err := builder.Build()
-		if err != nil {
-			return nil, fmt.Errorf("Failed to build descriptor for %v: %w", builder.GetName(), err)
+	for _, input := range s.order(s.descriptors).([]*desc.FileDescriptor) {
+		for _, fileBuilder := range s.fileBuilders[input.GetName()] {
+			if built[fileBuilder] {
+				continue
+			}
+			built[fileBuilder] = true
+
+			descriptor, err := fileBuilder.Build()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to build descriptor for %v: %w", fileBuilder.GetName(), err)
+			}
+			descriptor, err = s.setImportKinds(descriptor, fileBuilder)
+			if err != nil {
+				return nil, err
+			}
+			s.restoreDetachedComments(descriptor)
+			result = append(result, descriptor)
 		}
-		result = append(result, descriptor)
 	}
 
 	return result, nil
 }
 
 func FilterSet(descriptors []*desc.FileDescriptor, config *configuration.Configuration) ([]*desc.FileDescriptor, error) {
+	result, _, err := FilterSetWithReport(descriptors, config)
+	return result, err
+}
+
+// FilterSetWithReport is FilterSet but also returns a report of the changes that weren't directly requested by the
+// configuration (Like elements removed by cascade)
+func FilterSetWithReport(descriptors []*desc.FileDescriptor, config *configuration.Configuration) ([]*desc.FileDescriptor, *report.Report, error) {
 	state, err := initState(descriptors, config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = state.RunFilter()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	result, err := state.GetDescriptors()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return state.GetDescriptors()
+	return result, state.report, nil
 }
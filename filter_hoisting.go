@@ -0,0 +1,152 @@
+package protofilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/vbfox/proto-filter/report"
+)
+
+// hoistedType is a nested type moved out of a message that was only kept to contain it
+type hoistedType struct {
+	descriptor desc.Descriptor
+	builder    builder.Builder
+}
+
+// isHoistedContainer returns true if a message or file is only kept to contain referenced types that are hoisted, it
+// isn't part of the output by itself
+func (s *filteringState) isHoistedContainer(descriptor desc.Descriptor) bool {
+	return s.config.Hoisting.Enabled && s.containers[descriptor.GetFullyQualifiedName()]
+}
+
+// hoistNestedTypes create the builders of the nested types of a container, they are placed at the top level once
+// every file went through pass 1
+func (s *filteringState) hoistNestedTypes(descriptor *desc.MessageDescriptor) error {
+	for _, message := range s.order(descriptor.GetNestedMessageTypes()).([]*desc.MessageDescriptor) {
+		messageBuilder, err := s.Pass1Message(message)
+		if err != nil {
+			return fmt.Errorf("Error in message %s: %w", message.GetName(), err)
+		}
+		if messageBuilder != nil {
+			s.hoisted = append(s.hoisted, hoistedType{descriptor: message, builder: messageBuilder})
+		}
+	}
+
+	for _, enum := range s.order(descriptor.GetNestedEnumTypes()).([]*desc.EnumDescriptor) {
+		enumBuilder, err := s.Pass1Enum(enum)
+		if err != nil {
+			return fmt.Errorf("Error in enum %s: %w", enum.GetName(), err)
+		}
+		if enumBuilder != nil {
+			s.hoisted = append(s.hoisted, hoistedType{descriptor: enum, builder: enumBuilder})
+		}
+	}
+
+	return nil
+}
+
+// getHoistingTarget returns the input file where a hoisted type is placed
+func (s *filteringState) getHoistingTarget(hoisted hoistedType) (*desc.FileDescriptor, error) {
+	if s.config.Hoisting.File == "" {
+		return hoisted.descriptor.GetFile(), nil
+	}
+
+	for _, descriptor := range s.descriptors {
+		if descriptor.GetName() == s.config.Hoisting.File && s.IsIncluded(descriptor) {
+			return descriptor, nil
+		}
+	}
+	return nil, fmt.Errorf("Hoisting file %s isn't part of the output", s.config.Hoisting.File)
+}
+
+// isNameTaken returns true if a top level element already use a name in the package where it would be placed, the
+// name would otherwise collide once the output files of the package are compiled together
+func (s *filteringState) isNameTaken(input *desc.FileDescriptor, name string) bool {
+	pkg := s.getOutputPackage(input.GetPackage())
+	for _, fileBuilder := range s.outputFiles {
+		if fileBuilder.Package != pkg {
+			continue
+		}
+		if _, taken := s.symbolOrigins[fileBuilder][name]; taken {
+			return true
+		}
+	}
+	return false
+}
+
+// getHoistedNameCandidates returns the names a hoisted type can use by order of preference: its own name, then its
+// name prefixed by the names of its containers
+func getHoistedNameCandidates(hoisted hoistedType) []string {
+	parts := []string{hoisted.builder.GetName()}
+	for parent := hoisted.descriptor.GetParent(); parent != nil; parent = parent.GetParent() {
+		if _, isFile := parent.(*desc.FileDescriptor); isFile {
+			break
+		}
+		parts = append([]string{parent.GetName()}, parts...)
+	}
+
+	separator := ""
+	for _, part := range parts {
+		if !unicode.IsUpper([]rune(part)[0]) {
+			separator = "_"
+		}
+	}
+
+	result := []string{parts[len(parts)-1]}
+	if len(parts) > 1 {
+		result = append(result, strings.Join(parts, separator))
+	}
+	return result
+}
+
+// getHoistedName returns the first name of a hoisted type that doesn't collide with another top level element
+func (s *filteringState) getHoistedName(input *desc.FileDescriptor, hoisted hoistedType) string {
+	candidates := getHoistedNameCandidates(hoisted)
+	for _, candidate := range candidates {
+		if !s.isNameTaken(input, candidate) {
+			return candidate
+		}
+	}
+
+	base := candidates[len(candidates)-1]
+	for i := 2; ; i++ {
+		candidate := base + strconv.Itoa(i)
+		if !s.isNameTaken(input, candidate) {
+			return candidate
+		}
+	}
+}
+
+// hoistTypes add the hoisted types at the top level of their output file, references to them follow as they are
+// made via the builders
+func (s *filteringState) hoistTypes() error {
+	for _, hoisted := range s.hoisted {
+		input, err := s.getHoistingTarget(hoisted)
+		if err != nil {
+			return err
+		}
+
+		name := s.getHoistedName(input, hoisted)
+		switch typed := hoisted.builder.(type) {
+		case *builder.MessageBuilder:
+			err = typed.TrySetName(name)
+		case *builder.EnumBuilder:
+			err = typed.TrySetName(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.addToOutputFile(input, hoisted.builder); err != nil {
+			return err
+		}
+		s.report.Add(report.Hoist, hoisted.descriptor.GetFullyQualifiedName(), "Hoisted to the top level of %s as %s",
+			input.GetName(), name)
+	}
+
+	return nil
+}
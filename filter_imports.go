@@ -0,0 +1,122 @@
+package protofilter
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+// isFiltered returns true if the file is part of the filtered input and isn't an external dependency, other files
+// are only referenced by imports
+func (s *filteringState) isFiltered(fileName string) bool {
+	for _, descriptor := range s.descriptors {
+		if descriptor.GetName() == fileName {
+			return !s.config.External.IsExternal(descriptor.GetName(), descriptor.GetPackage())
+		}
+	}
+	return false
+}
+
+// addDependency import a file in an output file, using the files where its elements are output if it is filtered.
+// It returns the names of the imported files, an output file never import itself.
+func (s *filteringState) addDependency(fileBuilder *builder.FileBuilder, dependencyName string, dependency *desc.FileDescriptor) []string {
+	dependencyBuilders, isOutput := s.fileBuilders[dependencyName]
+	if !isOutput {
+		fileBuilder.AddImportedDependency(dependency)
+		return []string{dependencyName}
+	}
+
+	result := []string{}
+	for _, dependencyBuilder := range dependencyBuilders {
+		if dependencyBuilder != fileBuilder {
+			fileBuilder.AddDependency(dependencyBuilder)
+			result = append(result, dependencyBuilder.GetName())
+		}
+	}
+	return result
+}
+
+// addPublicDependencies keep the public imports of the input files, as long as the imported file still exists in the
+// output or isn't filtered at all. The imports are marked as public once the files are built.
+func (s *filteringState) addPublicDependencies() {
+	for _, descriptor := range s.descriptors {
+		for _, fileBuilder := range s.fileBuilders[descriptor.GetName()] {
+			for _, dependency := range descriptor.GetPublicDependencies() {
+				_, isOutput := s.fileBuilders[dependency.GetName()]
+				if !isOutput && s.isFiltered(dependency.GetName()) {
+					continue
+				}
+
+				outputNames := s.addDependency(fileBuilder, dependency.GetName(), dependency)
+				s.publicDependencies[fileBuilder] = append(s.publicDependencies[fileBuilder], outputNames...)
+			}
+		}
+	}
+}
+
+// getOutputNames returns the names of the files where the elements of a file are output, files that aren't output keep
+// their name
+func (s *filteringState) getOutputNames(fileName string) []string {
+	fileBuilders, isOutput := s.fileBuilders[fileName]
+	if !isOutput {
+		return []string{fileName}
+	}
+
+	result := []string{}
+	for _, fileBuilder := range fileBuilders {
+		result = append(result, fileBuilder.GetName())
+	}
+	return result
+}
+
+func indexOfDependency(dependencies []string, name string) int32 {
+	for i, dependency := range dependencies {
+		if dependency == name {
+			return int32(i)
+		}
+	}
+	return -1
+}
+
+// dependencyIndexes returns the indexes of the named files in the imports, each at most once
+func dependencyIndexes(dependencies []string, names []string) []int32 {
+	var result []int32
+	seen := map[int32]bool{}
+	for _, name := range names {
+		if index := indexOfDependency(dependencies, name); index >= 0 && !seen[index] {
+			seen[index] = true
+			result = append(result, index)
+		}
+	}
+	return result
+}
+
+// setImportKinds mark the imports of a built file as public or weak like they were in the input. The builder only
+// generate normal imports and drops the ones that aren't used anymore, so only the remaining ones are marked.
+func (s *filteringState) setImportKinds(descriptor *desc.FileDescriptor, fileBuilder *builder.FileBuilder) (*desc.FileDescriptor, error) {
+	weakDependencies := []string{}
+	for _, input := range s.outputInputs[fileBuilder] {
+		for _, dependency := range input.GetWeakDependencies() {
+			weakDependencies = append(weakDependencies, s.getOutputNames(dependency.GetName())...)
+		}
+	}
+
+	publicDependencies := s.publicDependencies[fileBuilder]
+	if len(publicDependencies) == 0 && len(weakDependencies) == 0 {
+		return descriptor, nil
+	}
+
+	fileProto := proto.Clone(descriptor.AsFileDescriptorProto()).(*dpb.FileDescriptorProto)
+	fileProto.PublicDependency = dependencyIndexes(fileProto.GetDependency(), publicDependencies)
+	fileProto.WeakDependency = dependencyIndexes(fileProto.GetDependency(), weakDependencies)
+
+	result, err := desc.CreateFileDescriptor(fileProto, descriptor.GetDependencies()...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set the kind of imports of %s: %w", descriptor.GetName(), err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package protofilter
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/builderutil"
+	"github.com/vbfox/proto-filter/report"
+)
+
+// getOutputPath returns the path of the output file where a top level element of an input file is placed, the type
+// name is only used by the type layout
+func (s *filteringState) getOutputPath(input *desc.FileDescriptor, typeName string) (string, error) {
+	layout := &s.config.Layout
+	switch layout.Mode {
+	case configuration.LayoutBundle:
+		return s.config.RewritePath(layout.Bundle)
+	case configuration.LayoutPackage, configuration.LayoutType:
+		data := configuration.NewLayoutTemplateData(s.getOutputPackage(input.GetPackage()), input.GetName(), typeName)
+		path, err := layout.RenderPath(data)
+		if err != nil {
+			return "", err
+		}
+		return s.config.RewritePath(path)
+	default:
+		return s.config.RewritePath(input.GetName())
+	}
+}
+
+// getOutputPackage returns the package of a file in the output, once package renames are applied
+func (s *filteringState) getOutputPackage(pkg string) string {
+	rename := s.config.FindPackageRename(pkg)
+	if rename == nil {
+		return pkg
+	}
+	result, _ := rename.Rename(pkg)
+	return result
+}
+
+// getOutputFile returns the output file where a top level element of an input file is placed, creating it for the
+// first element placed in it
+func (s *filteringState) getOutputFile(input *desc.FileDescriptor, typeName string) (*builder.FileBuilder, error) {
+	path, err := s.getOutputPath(input, typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	result, found := s.outputFiles[path]
+	if !found {
+		result = builder.NewFile(path)
+		builderutil.SetFileBasicInfo(result, input)
+		builderutil.SetAllComments(result, input)
+		for _, comments := range []*builder.Comments{result.GetComments(), &result.SyntaxComments, &result.PackageComments} {
+			if err := s.transformComments(comments, input.GetName()); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.copyOptions(result, input); err != nil {
+			return nil, err
+		}
+		if err := s.renamePackage(result, input); err != nil {
+			return nil, err
+		}
+
+		s.outputFiles[path] = result
+		s.symbolOrigins[result] = map[string]string{}
+	} else if !s.isInputOf(input, result) {
+		if err := s.mergeInputFile(result, input); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.isInputOf(input, result) {
+		s.outputInputs[result] = append(s.outputInputs[result], input)
+		s.fileBuilders[input.GetName()] = append(s.fileBuilders[input.GetName()], result)
+	}
+
+	return result, nil
+}
+
+func (s *filteringState) isInputOf(input *desc.FileDescriptor, fileBuilder *builder.FileBuilder) bool {
+	for _, existing := range s.outputInputs[fileBuilder] {
+		if existing == input {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeInputFile check that an input file can be placed in an output file that already contains other input files
+func (s *filteringState) mergeInputFile(fileBuilder *builder.FileBuilder, input *desc.FileDescriptor) error {
+	existing := s.outputInputs[fileBuilder][0]
+	if s.config.Layout.Mode == configuration.LayoutFiles {
+		return fmt.Errorf("Files %s and %s are both output as %s", existing.GetName(), input.GetName(),
+			fileBuilder.GetName())
+	}
+
+	if pkg := s.getOutputPackage(input.GetPackage()); pkg != fileBuilder.Package {
+		return fmt.Errorf("Can't merge %s in %s, its package %s is different from the package %s of %s",
+			input.GetName(), fileBuilder.GetName(), pkg, fileBuilder.Package, existing.GetName())
+	}
+
+	if input.IsProto3() != fileBuilder.IsProto3 {
+		return fmt.Errorf("Can't merge %s in %s, its syntax is different from the syntax of %s", input.GetName(),
+			fileBuilder.GetName(), existing.GetName())
+	}
+
+	// Only the options of the first file are kept, the other files need the same ones to be merged without changes
+	options := builder.NewFile(fileBuilder.GetName())
+	options.Package = input.GetPackage()
+	if err := s.copyOptions(options, input); err != nil {
+		return err
+	}
+	if err := s.renamePackage(options, input); err != nil {
+		return err
+	}
+	if !proto.Equal(options.Options, fileBuilder.Options) {
+		s.report.Add(report.Warning, input.GetName(), "File options are replaced by the ones of %s in %s",
+			existing.GetName(), fileBuilder.GetName())
+	}
+
+	return nil
+}
+
+// addToOutputFile add a top level element of an input file to the output file where it is placed, failing with both
+// input files named if another element with the same name was already placed in it
+func (s *filteringState) addToOutputFile(input *desc.FileDescriptor, element builder.Builder) error {
+	typeName := element.GetName()
+	if _, isExtension := element.(*builder.FieldBuilder); isExtension {
+		typeName = configuration.ExtensionsLayoutType
+	}
+
+	fileBuilder, err := s.getOutputFile(input, typeName)
+	if err != nil {
+		return err
+	}
+
+	origins := s.symbolOrigins[fileBuilder]
+	if origin, found := origins[element.GetName()]; found {
+		return fmt.Errorf("Name collision in %s: %s is defined in both %s and %s", fileBuilder.GetName(),
+			element.GetName(), origin, input.GetName())
+	}
+	origins[element.GetName()] = input.GetName()
+
+	switch typedElement := element.(type) {
+	case *builder.MessageBuilder:
+		return fileBuilder.TryAddMessage(typedElement)
+	case *builder.EnumBuilder:
+		return fileBuilder.TryAddEnum(typedElement)
+	case *builder.ServiceBuilder:
+		return fileBuilder.TryAddService(typedElement)
+	case *builder.FieldBuilder:
+		return fileBuilder.TryAddExtension(typedElement)
+	default:
+		return fmt.Errorf("Unexpected element %s of type %T", element.GetName(), element)
+	}
+}
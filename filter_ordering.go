@@ -0,0 +1,59 @@
+package protofilter
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/vbfox/proto-filter/configuration"
+)
+
+func (s *filteringState) isAlphabetical() bool {
+	return s.config.Ordering == configuration.OrderingAlphabetical
+}
+
+// outputNames sorts the output names of elements, swapping the elements along with them
+type outputNames struct {
+	names []string
+	swap  func(i, j int)
+}
+
+func (n outputNames) Len() int {
+	return len(n.names)
+}
+
+func (n outputNames) Less(i, j int) bool {
+	return n.names[i] < n.names[j]
+}
+
+func (n outputNames) Swap(i, j int) {
+	n.names[i], n.names[j] = n.names[j], n.names[i]
+	n.swap(i, j)
+}
+
+// order returns a slice of descriptors in the order they should appear in the output: sorted by their name in the
+// output once renamed for the alphabetical ordering, unchanged otherwise. Enum values are never ordered as the first
+// value of an enum has a special meaning.
+func (s *filteringState) order(elements interface{}) interface{} {
+	if !s.isAlphabetical() {
+		return elements
+	}
+
+	input := reflect.ValueOf(elements)
+	result := reflect.MakeSlice(input.Type(), input.Len(), input.Len())
+	reflect.Copy(result, input)
+
+	sorted := outputNames{names: make([]string, input.Len()), swap: reflect.Swapper(result.Interface())}
+	for i := range sorted.names {
+		descriptor := input.Index(i).Interface().(desc.Descriptor)
+		name, err := s.getOutputName(descriptor)
+		if err != nil {
+			// Returned once the element itself is renamed
+			name = descriptor.GetName()
+		}
+		sorted.names[i] = name
+	}
+	sort.Stable(sorted)
+
+	return result.Interface()
+}
@@ -2,73 +2,140 @@ package protofilter
 
 import (
 	"fmt"
+	"sort"
 
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/builder"
-	"github.com/vbfox/proto-filter/internal/builderutil"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/optionutil"
+	"github.com/vbfox/proto-filter/report"
 )
 
 func (s *filteringState) Pass1() error {
 	for _, descriptor := range s.descriptors {
-		fileBuilder, err := s.Pass1File(descriptor)
+		err := s.Pass1File(descriptor)
 		if err != nil {
 			return fmt.Errorf("Failed to filter file %s: %w", descriptor.GetName(), err)
 		}
-		if fileBuilder != nil {
-			s.fileBuilders[descriptor.GetFullyQualifiedName()] = fileBuilder
-		}
 	}
 
-	return nil
+	return s.hoistTypes()
 }
 
-func (s *filteringState) Pass1File(descriptor *desc.FileDescriptor) (*builder.FileBuilder, error) {
+func (s *filteringState) Pass1File(descriptor *desc.FileDescriptor) error {
 	if !s.IsIncluded(descriptor) {
-		return nil, nil
+		return nil
 	}
 
-	result := builder.NewFile(descriptor.GetName())
-
-	builderutil.SetFileBasicInfo(result, descriptor)
-	builderutil.SetAllComments(result, descriptor)
+	// With the type layout output files only exist for the types placed in them, like files that only contained
+	// hoisted types
+	if s.config.Layout.Mode != configuration.LayoutType && !s.isHoistedContainer(descriptor) {
+		if _, err := s.getOutputFile(descriptor, ""); err != nil {
+			return err
+		}
+	}
 
-	for _, message := range descriptor.GetMessageTypes() {
+	for _, message := range s.order(descriptor.GetMessageTypes()).([]*desc.MessageDescriptor) {
 		messageBuilder, err := s.Pass1Message(message)
 		if err != nil {
-			return nil, fmt.Errorf("Error in message %s: %w", message.GetName(), err)
+			return fmt.Errorf("Error in message %s: %w", message.GetName(), err)
 		}
 		if messageBuilder != nil {
-			if err := result.TryAddMessage(messageBuilder); err != nil {
-				return nil, err
+			if err := s.addToOutputFile(descriptor, messageBuilder); err != nil {
+				return err
 			}
 		}
 	}
 
-	for _, enum := range descriptor.GetEnumTypes() {
+	for _, enum := range s.order(descriptor.GetEnumTypes()).([]*desc.EnumDescriptor) {
 		enumBuilder, err := s.Pass1Enum(enum)
 		if err != nil {
-			return nil, fmt.Errorf("Error in enum %s: %w", enum.GetName(), err)
+			return fmt.Errorf("Error in enum %s: %w", enum.GetName(), err)
 		}
 		if enumBuilder != nil {
-			if err := result.TryAddEnum(enumBuilder); err != nil {
-				return nil, err
+			if err := s.addToOutputFile(descriptor, enumBuilder); err != nil {
+				return err
 			}
 		}
 	}
 
-	for _, service := range descriptor.GetServices() {
+	for _, service := range s.order(descriptor.GetServices()).([]*desc.ServiceDescriptor) {
 		serviceBuilder, err := s.Pass1Service(service)
 		if err != nil {
-			return nil, fmt.Errorf("Error in service %s: %w", service.GetName(), err)
+			return fmt.Errorf("Error in service %s: %w", service.GetName(), err)
 		}
 		if serviceBuilder != nil {
-			if err := result.TryAddService(serviceBuilder); err != nil {
-				return nil, err
+			if err := s.addToOutputFile(descriptor, serviceBuilder); err != nil {
+				return err
 			}
 		}
 	}
 
-	return result, nil
+	return nil
+}
+
+// renamePackage apply the package rename rules of the configuration to a file, references to the types of the file
+// from other output files follow as they are made via the builders. The options set by option rules matching the input
+// file win over the ones of the package rename.
+func (s *filteringState) renamePackage(fileBuilder *builder.FileBuilder, input *desc.FileDescriptor) error {
+	rename := s.config.FindPackageRename(fileBuilder.Package)
+	if rename == nil {
+		return nil
+	}
+
+	fileBuilder.Package, _ = rename.Rename(fileBuilder.Package)
+	if len(rename.Options) == 0 {
+		return nil
+	}
+
+	data := configuration.NewPackageTemplateData(fileBuilder.Package, fileBuilder.GetName())
+	rendered, err := rename.RenderOptions(data)
+	if err != nil {
+		return fmt.Errorf("Failed to rename package of %s: %w", fileBuilder.GetName(), err)
+	}
+
+	rules, err := s.getOptionRules(input)
+	if err != nil {
+		return fmt.Errorf("Failed to rename package of %s: %w", fileBuilder.GetName(), err)
+	}
+	setByRules := map[string]bool{}
+	for _, rule := range rules {
+		for name := range rule.GetValues() {
+			setByRules[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string]interface{}{}
+	for _, name := range names {
+		if setByRules[name] {
+			s.report.Add(report.Warning, input.GetName(),
+				"Option %s set by the rename of package %s is replaced by an option rule", name, input.GetPackage())
+			continue
+		}
+		values[name] = rendered[name]
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	options := fileBuilder.Options
+	if options == nil {
+		options = &dpb.FileOptions{}
+	}
+	newOptions, err := optionutil.SetFields(options, values)
+	if err != nil {
+		return fmt.Errorf("Failed to rename package of %s: %w", fileBuilder.GetName(), err)
+	}
+	fileBuilder.Options = newOptions.(*dpb.FileOptions)
+
+	return nil
 }
 
 func (s *filteringState) Pass1Message(descriptor *desc.MessageDescriptor) (*builder.MessageBuilder, error) {
@@ -76,10 +143,28 @@ func (s *filteringState) Pass1Message(descriptor *desc.MessageDescriptor) (*buil
 		return nil, nil
 	}
 
-	result := builder.NewMessage(descriptor.GetName())
+	if s.isHoistedContainer(descriptor) {
+		return nil, s.hoistNestedTypes(descriptor)
+	}
+
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := builder.NewMessage(name)
 	s.messageBuilders[descriptor.GetFullyQualifiedName()] = result
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	result.SetExtensionRanges(descriptor.AsDescriptorProto().GetExtensionRange())
+	result.SetReservedRanges(descriptor.AsDescriptorProto().GetReservedRange())
+	result.SetReservedNames(descriptor.AsDescriptorProto().GetReservedName())
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
-	for _, message := range descriptor.GetNestedMessageTypes() {
+	for _, message := range s.order(descriptor.GetNestedMessageTypes()).([]*desc.MessageDescriptor) {
 		messageBuilder, err := s.Pass1Message(message)
 		if err != nil {
 			return nil, fmt.Errorf("Error in message %s: %w", message.GetName(), err)
@@ -91,7 +176,7 @@ func (s *filteringState) Pass1Message(descriptor *desc.MessageDescriptor) (*buil
 		}
 	}
 
-	for _, enum := range descriptor.GetNestedEnumTypes() {
+	for _, enum := range s.order(descriptor.GetNestedEnumTypes()).([]*desc.EnumDescriptor) {
 		enumBuilder, err := s.Pass1Enum(enum)
 		if err != nil {
 			return nil, fmt.Errorf("Error in enum %s: %w", enum.GetName(), err)
@@ -111,8 +196,21 @@ func (s *filteringState) Pass1Enum(descriptor *desc.EnumDescriptor) (*builder.En
 		return nil, nil
 	}
 
-	result := builder.NewEnum(descriptor.GetName())
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := builder.NewEnum(name)
 	s.enumBuilders[descriptor.GetFullyQualifiedName()] = result
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	result.SetReservedRanges(descriptor.AsEnumDescriptorProto().GetReservedRange())
+	result.SetReservedNames(descriptor.AsEnumDescriptorProto().GetReservedName())
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
 	for _, enumValue := range descriptor.GetValues() {
 		enumValueBuilder, err := s.Pass1EnumValue(enumValue)
@@ -126,17 +224,51 @@ func (s *filteringState) Pass1Enum(descriptor *desc.EnumDescriptor) (*builder.En
 		}
 	}
 
+	if s.config.ReserveRemoved {
+		s.reserveRemovedEnumValues(result, descriptor)
+	}
+
 	return result, nil
 }
 
+// reserveRemovedEnumValues reserve the numbers of the removed values of an enum, numbers still used by an alias that
+// is kept aren't reserved. Names aren't reserved as they would leak the removed values in the output.
+func (s *filteringState) reserveRemovedEnumValues(result *builder.EnumBuilder, descriptor *desc.EnumDescriptor) {
+	usedNumbers := map[int32]bool{}
+	for _, enumValue := range descriptor.GetValues() {
+		if s.IsIncluded(enumValue) {
+			usedNumbers[enumValue.GetNumber()] = true
+		}
+	}
+
+	for _, enumValue := range descriptor.GetValues() {
+		number := enumValue.GetNumber()
+		if !usedNumbers[number] {
+			result.AddReservedRange(number, number)
+			usedNumbers[number] = true
+		}
+	}
+}
+
 func (s *filteringState) Pass1EnumValue(descriptor *desc.EnumValueDescriptor) (*builder.EnumValueBuilder, error) {
 	if !s.IsIncluded(descriptor) {
 		return nil, nil
 	}
 
-	result := builder.NewEnumValue(descriptor.GetName())
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := builder.NewEnumValue(name)
 
 	result.SetNumber(descriptor.GetNumber())
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -146,8 +278,19 @@ func (s *filteringState) Pass1Service(descriptor *desc.ServiceDescriptor) (*buil
 		return nil, nil
 	}
 
-	result := builder.NewService(descriptor.GetName())
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := builder.NewService(name)
 	s.serviceBuilders[descriptor.GetFullyQualifiedName()] = result
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -3,9 +3,12 @@ package protofilter
 import (
 	"fmt"
 
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/builder"
-	"github.com/vbfox/proto-filter/internal/builderutil"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/substitution"
+	"github.com/vbfox/proto-filter/report"
 )
 
 func (s *filteringState) Pass2() error {
@@ -20,8 +23,7 @@ func (s *filteringState) Pass2() error {
 }
 
 func (s *filteringState) Pass2File(descriptor *desc.FileDescriptor) error {
-	_, found := s.fileBuilders[descriptor.GetFullyQualifiedName()]
-	if !found {
+	if !s.IsIncluded(descriptor) {
 		return nil
 	}
 
@@ -39,12 +41,24 @@ func (s *filteringState) Pass2File(descriptor *desc.FileDescriptor) error {
 		}
 	}
 
+	for _, extension := range s.order(descriptor.GetExtensions()).([]*desc.FieldDescriptor) {
+		extensionBuilder, err := s.Pass2Extension(extension)
+		if err != nil {
+			return fmt.Errorf("Error in extension %s: %w", extension.GetName(), err)
+		}
+		if extensionBuilder != nil {
+			if err := s.addToOutputFile(descriptor, extensionBuilder); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
 func (s *filteringState) Pass2Message(descriptor *desc.MessageDescriptor) error {
 	result, found := s.messageBuilders[descriptor.GetFullyQualifiedName()]
-	if !found {
+	if !found && !s.isHoistedContainer(descriptor) {
 		return nil
 	}
 
@@ -55,43 +69,272 @@ func (s *filteringState) Pass2Message(descriptor *desc.MessageDescriptor) error
 		}
 	}
 
-	for _, field := range descriptor.GetFields() {
+	if !found {
+		// The nested types were hoisted, the container itself isn't part of the output
+		return nil
+	}
+
+	oneOfBuilders := map[string]*builder.OneOfBuilder{}
+	for _, field := range s.order(descriptor.GetFields()).([]*desc.FieldDescriptor) {
 		fieldBuilder, err := s.Pass2Field(field)
 		if err != nil {
 			return fmt.Errorf("Error in field %s: %w", field.GetName(), err)
 		}
-		if fieldBuilder != nil {
+		if fieldBuilder == nil {
+			continue
+		}
+
+		oneOf := field.GetOneOf()
+		if oneOf != nil && !s.isFlattenedOneOf(oneOf) {
+			oneOfBuilder, found := oneOfBuilders[oneOf.GetName()]
+			if !found {
+				oneOfBuilder, err = s.Pass2OneOf(oneOf)
+				if err != nil {
+					return fmt.Errorf("Error in oneof %s: %w", oneOf.GetName(), err)
+				}
+				oneOfBuilders[oneOf.GetName()] = oneOfBuilder
+				if err := result.TryAddOneOf(oneOfBuilder); err != nil {
+					return err
+				}
+			}
+			if err := oneOfBuilder.TryAddChoice(fieldBuilder); err != nil {
+				return err
+			}
+		} else {
+			if oneOf != nil && descriptor.GetFile().IsProto3() && field.GetMessageType() == nil {
+				s.report.Add(report.Warning, field.GetFullyQualifiedName(),
+					"Flattened out of oneof %s, proto3 scalar fields don't track presence", oneOf.GetName())
+			}
 			if err := result.TryAddField(fieldBuilder); err != nil {
 				return err
 			}
 		}
 	}
 
+	for _, extension := range s.order(descriptor.GetNestedExtensions()).([]*desc.FieldDescriptor) {
+		extensionBuilder, err := s.Pass2Extension(extension)
+		if err != nil {
+			return fmt.Errorf("Error in extension %s: %w", extension.GetName(), err)
+		}
+		if extensionBuilder != nil {
+			if err := result.TryAddNestedExtension(extensionBuilder); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Containers don't publish any of their fields, their numbers aren't part of the output API
+	if s.config.ReserveRemoved && !s.containers[descriptor.GetFullyQualifiedName()] {
+		s.reserveRemovedFields(result, descriptor)
+	}
+
 	return nil
 }
 
-func (s *filteringState) Pass2Field(descriptor *desc.FieldDescriptor) (*builder.FieldBuilder, error) {
-	if !s.IsIncluded(descriptor) {
-		return nil, nil
+// reserveRemovedFields reserve the numbers of the removed fields of a message, like for reserveRemovedEnumValues only
+// numbers are reserved
+func (s *filteringState) reserveRemovedFields(result *builder.MessageBuilder, descriptor *desc.MessageDescriptor) {
+	for _, field := range descriptor.GetFields() {
+		if !s.IsIncluded(field) {
+			result.AddReservedRange(field.GetNumber(), field.GetNumber())
+		}
+	}
+}
+
+// isFlattenedOneOf returns true if the members of a oneof should be output as normal fields, it's the case when the
+// policy is to flatten oneofs that are left with a single member after filtering
+func (s *filteringState) isFlattenedOneOf(descriptor *desc.OneOfDescriptor) bool {
+	if s.config.OneOfPolicy != configuration.OneOfPolicyFlatten {
+		return false
 	}
 
-	var fieldType *builder.FieldType
+	choices := descriptor.GetChoices()
+	includedChoices := 0
+	for _, field := range choices {
+		if s.IsIncluded(field) {
+			includedChoices++
+		}
+	}
+
+	return includedChoices == 1 && len(choices) > 1
+}
+
+// Pass2OneOf create the builder for a oneof, the oneof is only created once one of its members is included so that
+// empty oneofs are never generated
+func (s *filteringState) Pass2OneOf(descriptor *desc.OneOfDescriptor) (*builder.OneOfBuilder, error) {
+	result := builder.NewOneOf(descriptor.GetName())
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// checkImportable returns an error if a type without builder can't be referenced from its original file, it's the case
+// for the types of the filtered files that were excluded
+func (s *filteringState) checkImportable(element desc.Descriptor, referenced desc.Descriptor) error {
+	if s.isFiltered(referenced.GetFile().GetName()) {
+		return fmt.Errorf("%s references %s that is excluded from the output", element.GetFullyQualifiedName(),
+			referenced.GetFullyQualifiedName())
+	}
+	return nil
+}
+
+// getFieldType returns the type of the field in the output, referencing the builders of the filtered messages and
+// enums. The element is the field or map field that errors are about.
+func (s *filteringState) getFieldType(element desc.Descriptor, descriptor *desc.FieldDescriptor) (*builder.FieldType, error) {
 	messageType := descriptor.GetMessageType()
 	enumType := descriptor.GetEnumType()
 	if messageType != nil {
-		messageTypeBuilder := s.messageBuilders[messageType.GetFullyQualifiedName()]
-		fieldType = builder.FieldTypeMessage(messageTypeBuilder)
+		messageTypeBuilder, found := s.messageBuilders[messageType.GetFullyQualifiedName()]
+		if !found {
+			return builder.FieldTypeImportedMessage(messageType), s.checkImportable(element, messageType)
+		}
+		return builder.FieldTypeMessage(messageTypeBuilder), nil
 	} else if enumType != nil {
-		enumTypeBuilder := s.enumBuilders[enumType.GetFullyQualifiedName()]
-		fieldType = builder.FieldTypeEnum(enumTypeBuilder)
+		enumTypeBuilder, found := s.enumBuilders[enumType.GetFullyQualifiedName()]
+		if !found {
+			return builder.FieldTypeImportedEnum(enumType), s.checkImportable(element, enumType)
+		}
+		return builder.FieldTypeEnum(enumTypeBuilder), nil
+	}
+	return builder.FieldTypeScalar(descriptor.GetType()), nil
+}
+
+// substituteField create a field with its type replaced as configured, substitutions that consumers of the original
+// schema can't read are reported as warnings
+func (s *filteringState) substituteField(descriptor *desc.FieldDescriptor, name string, typeSubstitution *configuration.TypeSubstitution) (*builder.FieldBuilder, error) {
+	var fieldType *builder.FieldType
+	var message *desc.MessageDescriptor
+	if typeSubstitution.Type == configuration.SubstituteBytes {
+		fieldType = builder.FieldTypeScalar(dpb.FieldDescriptorProto_TYPE_BYTES)
+	} else {
+		var err error
+		message, err = substitution.ResolveMessage(s.descriptors, typeSubstitution.Type)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to substitute the type of %s: %w", descriptor.GetFullyQualifiedName(), err)
+		}
+		if messageBuilder, found := s.messageBuilders[message.GetFullyQualifiedName()]; found {
+			fieldType = builder.FieldTypeMessage(messageBuilder)
+		} else {
+			if err := s.checkImportable(descriptor, message); err != nil {
+				return nil, err
+			}
+			fieldType = builder.FieldTypeImportedMessage(message)
+		}
+	}
+
+	if !substitution.IsWireCompatible(descriptor, message) {
+		s.report.Add(report.Warning, descriptor.GetFullyQualifiedName(),
+			"Type substituted by %s isn't wire compatible with the original type", typeSubstitution.Type)
+	}
+
+	result := builder.NewField(name, fieldType)
+	if descriptor.IsMap() {
+		result.SetLabel(dpb.FieldDescriptorProto_LABEL_REPEATED)
 	} else {
-		fieldType = builder.FieldTypeScalar(descriptor.GetType())
+		result.SetLabel(descriptor.GetLabel())
+	}
+
+	return result, nil
+}
+
+func (s *filteringState) Pass2Field(descriptor *desc.FieldDescriptor) (*builder.FieldBuilder, error) {
+	if !s.IsIncluded(descriptor) {
+		return nil, nil
+	}
+
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	typeSubstitution, err := substitution.Find(s.config, descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *builder.FieldBuilder
+	if typeSubstitution != nil {
+		result, err = s.substituteField(descriptor, name, typeSubstitution)
+		if err != nil {
+			return nil, err
+		}
+	} else if descriptor.IsMap() {
+		keyType, err := s.getFieldType(descriptor, descriptor.GetMapKeyType())
+		if err != nil {
+			return nil, err
+		}
+		valueType, err := s.getFieldType(descriptor, descriptor.GetMapValueType())
+		if err != nil {
+			return nil, err
+		}
+		result = builder.NewMapField(name, keyType, valueType)
+	} else if descriptor.GetType() == dpb.FieldDescriptorProto_TYPE_GROUP {
+		// The group message was created as a nested message in pass 1, the group field takes ownership of it
+		groupBuilder := s.messageBuilders[descriptor.GetMessageType().GetFullyQualifiedName()]
+		result = builder.NewGroupField(groupBuilder)
+		result.SetLabel(descriptor.GetLabel())
+	} else {
+		fieldType, err := s.getFieldType(descriptor, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		result = builder.NewField(name, fieldType)
+		result.SetLabel(descriptor.GetLabel())
+	}
+
+	fieldProto := descriptor.AsFieldDescriptorProto()
+	if fieldProto.DefaultValue != nil && typeSubstitution == nil {
+		result.SetDefaultValue(s.getDefaultValue(descriptor))
 	}
 
-	result := builder.NewField(descriptor.GetName(), fieldType)
-	result.SetLabel(descriptor.GetLabel())
 	result.SetNumber(descriptor.GetNumber())
-	builderutil.SetComments(result.GetComments(), descriptor.GetSourceInfo())
+	result.SetJsonName(descriptor.GetJSONName())
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Pass2Extension create the builder for an extension, extended messages that aren't part of the output are referenced
+// from their original file
+func (s *filteringState) Pass2Extension(descriptor *desc.FieldDescriptor) (*builder.FieldBuilder, error) {
+	if !s.IsIncluded(descriptor) {
+		return nil, nil
+	}
+
+	extendee := descriptor.GetOwner()
+	fieldType, err := s.getFieldType(descriptor, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	var result *builder.FieldBuilder
+	if extendeeBuilder, found := s.messageBuilders[extendee.GetFullyQualifiedName()]; found {
+		result = builder.NewExtension(descriptor.GetName(), descriptor.GetNumber(), fieldType, extendeeBuilder)
+	} else {
+		result = builder.NewExtensionImported(descriptor.GetName(), descriptor.GetNumber(), fieldType, extendee)
+	}
+
+	result.SetLabel(descriptor.GetLabel())
+	fieldProto := descriptor.AsFieldDescriptorProto()
+	if fieldProto.DefaultValue != nil {
+		result.SetDefaultValue(s.getDefaultValue(descriptor))
+	}
+
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
@@ -102,8 +345,11 @@ func (s *filteringState) Pass2Service(descriptor *desc.ServiceDescriptor) error
 		return nil
 	}
 
-	for _, method := range descriptor.GetMethods() {
-		methodBuilder := s.Pass2Method(method)
+	for _, method := range s.order(descriptor.GetMethods()).([]*desc.MethodDescriptor) {
+		methodBuilder, err := s.Pass2Method(method)
+		if err != nil {
+			return fmt.Errorf("Error in method %s: %w", method.GetName(), err)
+		}
 		if methodBuilder != nil {
 			if err := result.TryAddMethod(methodBuilder); err != nil {
 				return err
@@ -114,19 +360,42 @@ func (s *filteringState) Pass2Service(descriptor *desc.ServiceDescriptor) error
 	return nil
 }
 
-func (s *filteringState) Pass2Method(descriptor *desc.MethodDescriptor) *builder.MethodBuilder {
+// getRpcType returns the type of a method request or response in the output, messages that aren't part of the filtered
+// files are referenced from their original file
+func (s *filteringState) getRpcType(method *desc.MethodDescriptor, descriptor *desc.MessageDescriptor, stream bool) (*builder.RpcType, error) {
+	messageBuilder, found := s.messageBuilders[descriptor.GetFullyQualifiedName()]
+	if !found {
+		return builder.RpcTypeImportedMessage(descriptor, stream), s.checkImportable(method, descriptor)
+	}
+	return builder.RpcTypeMessage(messageBuilder, stream), nil
+}
+
+func (s *filteringState) Pass2Method(descriptor *desc.MethodDescriptor) (*builder.MethodBuilder, error) {
 	if !s.IsIncluded(descriptor) {
-		return nil
+		return nil, nil
 	}
 
-	reqBuilder := s.messageBuilders[descriptor.GetInputType().GetFullyQualifiedName()]
-	req := builder.RpcTypeMessage(reqBuilder, descriptor.IsClientStreaming())
+	req, err := s.getRpcType(descriptor, descriptor.GetInputType(), descriptor.IsClientStreaming())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.getRpcType(descriptor, descriptor.GetOutputType(), descriptor.IsServerStreaming())
+	if err != nil {
+		return nil, err
+	}
 
-	respBuilder := s.messageBuilders[descriptor.GetOutputType().GetFullyQualifiedName()]
-	resp := builder.RpcTypeMessage(respBuilder, descriptor.IsServerStreaming())
+	name, err := s.renameElement(descriptor)
+	if err != nil {
+		return nil, err
+	}
 
-	result := builder.NewMethod(descriptor.GetName(), req, resp)
-	builderutil.SetComments(result.GetComments(), descriptor.GetSourceInfo())
+	result := builder.NewMethod(name, req, resp)
+	if err := s.setComments(result, descriptor); err != nil {
+		return nil, err
+	}
+	if err := s.copyOptions(result, descriptor); err != nil {
+		return nil, err
+	}
 
-	return result
+	return result, nil
 }
@@ -0,0 +1,118 @@
+package protofilter
+
+import (
+	"fmt"
+
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/included"
+	"github.com/vbfox/proto-filter/internal/selector"
+	"github.com/vbfox/proto-filter/report"
+)
+
+// findRenameRule returns the first rename rule matching an element or nil if it isn't renamed
+func (s *filteringState) findRenameRule(descriptor desc.Descriptor) (*configuration.RenameRule, error) {
+	switch selector.GetKind(descriptor) {
+	case configuration.ElementKindMessage, configuration.ElementKindField, configuration.ElementKindEnum,
+		configuration.ElementKindEnumValue, configuration.ElementKindService, configuration.ElementKindMethod:
+	default:
+		return nil, nil
+	}
+
+	for _, rule := range s.config.Renames {
+		matches, err := selector.Matches(&rule.Match, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			return rule, nil
+		}
+	}
+	return nil, nil
+}
+
+// isGroup returns true for group fields and the messages defined by groups, their names are linked
+func isGroup(descriptor desc.Descriptor) bool {
+	switch typed := descriptor.(type) {
+	case *desc.FieldDescriptor:
+		return typed.GetType() == dpb.FieldDescriptorProto_TYPE_GROUP
+	case *desc.MessageDescriptor:
+		return included.IsGroupMessage(typed)
+	}
+	return false
+}
+
+// getRenameWarning returns why renaming an element can break compatibility, if it can
+func getRenameWarning(descriptor desc.Descriptor) string {
+	switch descriptor.(type) {
+	case *desc.EnumValueDescriptor:
+		return "Enum values are named in JSON, renaming them changes their JSON representation"
+	case *desc.ServiceDescriptor, *desc.MethodDescriptor:
+		return "Services and methods are named in RPC paths, renaming them changes their path"
+	}
+	return ""
+}
+
+// getOutputName returns the name of an element in the output, once the first rename rule matching it is applied
+func (s *filteringState) getOutputName(descriptor desc.Descriptor) (string, error) {
+	rule, err := s.findRenameRule(descriptor)
+	if err != nil || rule == nil {
+		return descriptor.GetName(), err
+	}
+
+	name, err := rule.Rename(descriptor.GetName())
+	if err != nil {
+		return "", fmt.Errorf("Failed to rename %s: %w", descriptor.GetFullyQualifiedName(), err)
+	}
+	return name, nil
+}
+
+// renameElement returns the name of an element in the output and reports it if it's renamed. References to the renamed
+// elements follow as they are made via the builders.
+func (s *filteringState) renameElement(descriptor desc.Descriptor) (string, error) {
+	name, err := s.getOutputName(descriptor)
+	if err != nil {
+		return "", err
+	}
+	if name == descriptor.GetName() {
+		return name, nil
+	}
+
+	if isGroup(descriptor) {
+		return "", fmt.Errorf("Groups can't be renamed")
+	}
+
+	s.renames[descriptor.GetFullyQualifiedName()] = name
+	if field, isField := descriptor.(*desc.FieldDescriptor); isField {
+		s.report.Add(report.Rename, descriptor.GetFullyQualifiedName(), "Renamed to %s, keeping %s as JSON name", name,
+			field.GetJSONName())
+	} else {
+		s.report.Add(report.Rename, descriptor.GetFullyQualifiedName(), "Renamed to %s", name)
+	}
+
+	if warning := getRenameWarning(descriptor); warning != "" {
+		s.report.Add(report.Warning, descriptor.GetFullyQualifiedName(), "%s", warning)
+	}
+
+	return name, nil
+}
+
+// getDefaultValue returns the default value of a field in the output, defaults of enum fields are the names of enum
+// values that could be renamed
+func (s *filteringState) getDefaultValue(descriptor *desc.FieldDescriptor) string {
+	defaultValue := descriptor.AsFieldDescriptorProto().GetDefaultValue()
+	enum := descriptor.GetEnumType()
+	if enum == nil {
+		return defaultValue
+	}
+
+	value := enum.FindValueByName(defaultValue)
+	if value == nil {
+		return defaultValue
+	}
+	if name, renamed := s.renames[value.GetFullyQualifiedName()]; renamed {
+		return name
+	}
+	return defaultValue
+}
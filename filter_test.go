@@ -1,9 +1,11 @@
 package protofilter
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/vbfox/proto-filter/report"
 	. "github.com/vbfox/proto-filter/testutils"
 )
 
@@ -360,7 +362,7 @@ include:
   - test.proto:
     - svc_a
 exclude:
-  - test.proto
+  - test.proto:
     - svc_a:
       - method_a_2
 `,
@@ -404,3 +406,2807 @@ service svc_a {
 `,
 	)
 }
+
+func TestNestedMessageReference(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  msg_b.msg_c field_a_1 = 1;
+}
+
+message msg_b {
+  message msg_c {
+    string field_c_1 = 1;
+  }
+
+  string field_b_1 = 1;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  msg_b.msg_c field_a_1 = 1;
+}
+
+message msg_b {
+  message msg_c {
+    string field_c_1 = 1;
+  }
+}
+`,
+	)
+}
+
+func TestCascadeExclusion(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+cascade_exclusions: true
+include:
+  - test.proto:
+    - msg_a
+    - svc_a
+exclude:
+  - test.proto:
+    - msg_b
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  msg_b field_a_2 = 2;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+
+  rpc method_a_2 ( msg_a ) returns ( msg_b );
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	removed := actualReport.OfKind(report.CascadedRemoval)
+	assert.Len(removed, 2)
+	assert.Equal("msg_a.field_a_2", removed[0].Element)
+	assert.Equal("svc_a.method_a_2", removed[1].Element)
+}
+
+func TestExcludeMethodsBySelector(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - svc_a
+selectors:
+  - action: exclude
+    match:
+      kind: method
+      streaming: bidi
+  - action: exclude
+    match:
+      streaming: server
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+
+  rpc method_a_2 ( stream msg_a ) returns ( stream msg_a );
+
+  rpc method_a_3 ( msg_a ) returns ( stream msg_a );
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+`,
+	)
+}
+
+func TestOneOfIsKept(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  // The payload
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_2 = 3;
+  }
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  // The payload
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_2 = 3;
+  }
+}
+`,
+	)
+}
+
+func TestOneOfMemberExcluded(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - payload:
+        - variant_2
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_2 = 3;
+
+    int32 variant_3 = 4;
+  }
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_3 = 4;
+  }
+}
+`,
+	)
+}
+
+func TestEmptyOneOfIsDropped(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - variant_1
+      - variant_2
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_2 = 3;
+  }
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`,
+	)
+}
+
+func TestOneOfPolicyFlatten(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+oneof_policy: flatten
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - variant_2
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  oneof payload {
+    string variant_1 = 2;
+
+    int32 variant_2 = 3;
+  }
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  string variant_1 = 2;
+}
+`,
+	)
+}
+
+func TestOneOfPolicyFlattenWarnsProto3(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+oneof_policy: flatten
+include:
+  - test.proto
+exclude:
+  - test.proto:
+    - msg_a:
+      - variant_2
+      - variant_4
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  oneof payload {
+    string variant_1 = 1;
+
+    int32 variant_2 = 2;
+  }
+
+  oneof details {
+    msg_b variant_3 = 3;
+
+    int32 variant_4 = 4;
+  }
+}
+
+message msg_b {
+}
+`)
+	_, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+
+	warnings := actualReport.OfKind(report.Warning)
+	assert.Len(warnings, 1)
+	assert.Equal("msg_a.variant_1", warnings[0].Element)
+}
+
+func TestMapFields(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  map<int32, string> field_a_1 = 1;
+
+  map<string, enum_b> field_a_2 = 2;
+
+  map<uint64, msg_a.msg_c> field_a_3 = 3;
+
+  message msg_c {
+    string field_c_1 = 1;
+  }
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  map<int32, string> field_a_1 = 1;
+
+  map<string, enum_b> field_a_2 = 2;
+
+  map<uint64, msg_c> field_a_3 = 3;
+
+  message msg_c {
+    string field_c_1 = 1;
+  }
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+}
+`,
+	)
+}
+
+func TestExcludeMapFieldsBySelector(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+selectors:
+  - action: exclude
+    match:
+      map_value_type: msg_b
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  map<string, msg_b> field_a_1 = 1;
+
+  map<string, string> field_a_2 = 2;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  map<string, string> field_a_2 = 2;
+}
+`,
+	)
+}
+
+func TestStandardOptionsAreKept(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+    - svc_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  option deprecated = true;
+
+  repeated int32 field_a_1 = 1 [packed = false];
+
+  string field_a_2 = 2 [deprecated = true, json_name = "fieldA2Custom"];
+
+  enum_b field_a_3 = 3;
+}
+
+enum enum_b {
+  option allow_alias = true;
+
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1 [deprecated = true];
+
+  VALUE_B_1_ALIAS = 1;
+}
+
+service svc_a {
+  option deprecated = true;
+
+  rpc method_a_1 ( msg_a ) returns ( msg_a ) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  option deprecated = true;
+
+  repeated int32 field_a_1 = 1 [packed = false];
+
+  string field_a_2 = 2 [deprecated = true, json_name = "fieldA2Custom"];
+
+  enum_b field_a_3 = 3;
+}
+
+enum enum_b {
+  option allow_alias = true;
+
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1 [deprecated = true];
+
+  VALUE_B_1_ALIAS = 1;
+}
+
+service svc_a {
+  option deprecated = true;
+
+  rpc method_a_1 ( msg_a ) returns ( msg_a ) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`,
+	)
+}
+
+const customOptionsFile = `syntax = "proto3";
+
+package acme;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.MessageOptions {
+  string owner_team = 50000;
+}
+
+extend google.protobuf.FieldOptions {
+  bool sensitive = 50001;
+}
+`
+
+func TestCustomOptionsAreKept(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto:
+    - msg_a
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"options.proto": customOptionsFile,
+		"test.proto": `syntax = "proto3";
+
+import "options.proto";
+
+message msg_a {
+  option (acme.owner_team) = "search";
+
+  string field_a_1 = 1 [(acme.sensitive) = true];
+}
+`,
+	}, "test.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+import "options.proto";
+
+message msg_a {
+  option (acme.owner_team) = "search";
+
+  string field_a_1 = 1 [(acme.sensitive) = true];
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestOptionsFilter(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto:
+    - msg_a
+options:
+  deny:
+    - (acme.owner_team)
+    - java_*
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"options.proto": customOptionsFile,
+		"test.proto": `syntax = "proto3";
+
+import "options.proto";
+
+option java_package = "com.acme";
+
+option java_multiple_files = true;
+
+option go_package = "acme";
+
+message msg_a {
+  option (acme.owner_team) = "search";
+
+  option deprecated = true;
+
+  string field_a_1 = 1;
+}
+`,
+	}, "test.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+option go_package = "acme";
+
+message msg_a {
+  option deprecated = true;
+
+  string field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestProto2Features(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  required string field_a_1 = 1;
+
+  optional int32 field_a_2 = 2 [default = 42];
+
+  optional string field_a_3 = 3 [default = "abc"];
+
+  optional enum_b field_a_4 = 4 [default = VALUE_B_1];
+
+  repeated group Item = 5 {
+    optional string field_item_1 = 6;
+  }
+
+  extensions 100 to 199;
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1;
+}
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  required string field_a_1 = 1;
+
+  optional int32 field_a_2 = 2 [default = 42];
+
+  optional string field_a_3 = 3 [default = "abc"];
+
+  optional enum_b field_a_4 = 4 [default = VALUE_B_1];
+
+  repeated group Item = 5 {
+    optional string field_item_1 = 6;
+  }
+
+  extensions 100 to 199;
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1;
+}
+`,
+	)
+}
+
+func TestExcludeRequiredField(t *testing.T) {
+	assert := require.New(t)
+	input := `syntax = "proto2";
+
+message msg_a {
+  required string field_a_1 = 1;
+
+  optional string field_a_2 = 2;
+}
+`
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - field_a_1
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", input)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+
+	parsedConfig.AllowRequiredFieldRemoval = true
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto2";
+
+message msg_a {
+  optional string field_a_2 = 2;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	warnings := actualReport.OfKind(report.Warning)
+	assert.Len(warnings, 1)
+	assert.Equal("msg_a.field_a_1", warnings[0].Element)
+}
+
+func TestExcludeGroupField(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - result
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  optional string field_a_1 = 1;
+
+  optional group Result = 2 {
+    optional string field_result_1 = 3;
+  }
+}
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  optional string field_a_1 = 1;
+}
+`,
+	)
+}
+
+func TestRequiredFieldOfContainer(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_b
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  required string field_a_1 = 1;
+
+  message msg_a_a {
+    optional string field_a_a_1 = 1;
+  }
+}
+
+message msg_b {
+  optional msg_a.msg_a_a field_b_1 = 1;
+}
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  message msg_a_a {
+    optional string field_a_a_1 = 1;
+  }
+}
+
+message msg_b {
+  optional msg_a.msg_a_a field_b_1 = 1;
+}
+`,
+	)
+}
+
+func TestExtensions(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - ext_1
+    - msg_c:
+      - ext_2
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  optional string field_a_1 = 1;
+
+  extensions 100 to 199;
+}
+
+message msg_b {
+  optional string field_b_1 = 1;
+}
+
+message msg_c {
+  optional string field_c_1 = 1;
+
+  extend msg_a {
+    optional string ext_2 = 101;
+  }
+}
+
+message msg_d {
+  optional string field_d_1 = 1;
+}
+
+extend msg_a {
+  optional msg_b ext_1 = 100;
+
+  optional msg_d ext_3 = 102;
+}
+`,
+		`syntax = "proto2";
+
+message msg_a {
+  optional string field_a_1 = 1;
+
+  extensions 100 to 199;
+}
+
+message msg_b {
+  optional string field_b_1 = 1;
+}
+
+message msg_c {
+  extend msg_a {
+    optional string ext_2 = 101;
+  }
+}
+
+extend msg_a {
+  optional msg_b ext_1 = 100;
+}
+`,
+	)
+}
+
+func TestExtensionOfExcludedMessage(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+exclude:
+  - test.proto:
+    - msg_a
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto2";
+
+message msg_a {
+  optional string field_a_1 = 1;
+
+  extensions 100 to 199;
+}
+
+message msg_b {
+  optional string field_b_1 = 1;
+}
+
+extend msg_a {
+  optional msg_b ext_1 = 100;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto2";
+
+message msg_b {
+  optional string field_b_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	removals := actualReport.OfKind(report.CascadedRemoval)
+	assert.Len(removals, 1)
+	assert.Equal("ext_1", removals[0].Element)
+}
+
+func TestExtensionsOfImportedMessages(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - options.proto:
+    - owner_team
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"options.proto": customOptionsFile,
+	}, "options.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.MessageOptions {
+  string owner_team = 50000;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestReservedAreKept(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  reserved 2, 5 to 10;
+
+  reserved "field_a_2", "field_a_5";
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  reserved 1, 5 to 10;
+
+  reserved "VALUE_B_1";
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  reserved 2, 5 to 10;
+
+  reserved "field_a_2", "field_a_5";
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  reserved 1, 5 to 10;
+
+  reserved "VALUE_B_1";
+}
+`,
+	)
+}
+
+func TestReserveRemoved(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+reserve_removed: true
+include:
+  - test.proto
+exclude:
+  - test.proto:
+    - msg_a:
+      - field_a_2
+      - field_a_3
+    - enum_b:
+      - VALUE_B_1
+      - VALUE_B_ALIAS
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  string field_a_2 = 2;
+
+  string field_a_3 = 3;
+
+  reserved 4;
+}
+
+enum enum_b {
+  option allow_alias = true;
+
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1;
+
+  VALUE_B_2 = 2;
+
+  VALUE_B_ALIAS = 2;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  reserved 4, 2, 3;
+}
+
+enum enum_b {
+  option allow_alias = true;
+
+  VALUE_B_0 = 0;
+
+  VALUE_B_2 = 2;
+
+  reserved 1;
+}
+`,
+	)
+}
+
+func TestCommentsAreKept(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto
+`,
+		`syntax = "proto3";
+
+// Detached comment of msg_a
+
+// Comment of msg_a
+message msg_a {
+  // Comment of field_a_1
+  string field_a_1 = 1; // Trailing comment of field_a_1
+
+  // Detached comment of field_a_2
+
+  // Comment of field_a_2
+  string field_a_2 = 2;
+
+  // Comment of msg_c
+  message msg_c {
+  }
+}
+
+// Comment of enum_b
+enum enum_b {
+  // Comment of VALUE_B_0
+  VALUE_B_0 = 0; // Trailing comment of VALUE_B_0
+}
+
+// Comment of svc_a
+service svc_a {
+  // Comment of method_a_1
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+`,
+		`syntax = "proto3";
+
+// Detached comment of msg_a
+
+// Comment of msg_a
+message msg_a {
+  // Comment of field_a_1
+  string field_a_1 = 1; // Trailing comment of field_a_1
+
+  // Detached comment of field_a_2
+
+  // Comment of field_a_2
+  string field_a_2 = 2;
+
+  // Comment of msg_c
+  message msg_c {
+  }
+}
+
+// Comment of enum_b
+enum enum_b {
+  // Comment of VALUE_B_0
+  VALUE_B_0 = 0; // Trailing comment of VALUE_B_0
+}
+
+// Comment of svc_a
+service svc_a {
+  // Comment of method_a_1
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+`,
+	)
+}
+
+func TestReferenceToExcludedTypeFails(t *testing.T) {
+	assert := require.New(t)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  msg_b field_a_2 = 2;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_b ) returns ( msg_b );
+}
+`)
+
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_b
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "msg_a.field_a_2 references msg_b that is excluded from the output")
+
+	parsedConfig = ConfFromString(assert, `---
+include:
+  - test.proto:
+    - svc_a
+exclude:
+  - test.proto:
+    - msg_b
+`)
+	_, err = FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "svc_a.method_a_1 references msg_b that is excluded from the output")
+}
+
+func TestImports(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - a.proto:
+    - msg_a
+  - c.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto3";
+
+import "b.proto";
+import public "c.proto";
+import public "d.proto";
+import "e.proto";
+
+message msg_a {
+  msg_b field_a_1 = 1;
+}
+
+message msg_a_2 {
+  msg_e field_a_2_1 = 1;
+}
+`,
+		"b.proto": `syntax = "proto3";
+
+message msg_b {
+  string field_b_1 = 1;
+}
+
+message msg_b_2 {
+  string field_b_2_1 = 1;
+}
+`,
+		"c.proto": `syntax = "proto3";
+
+message msg_c {
+  string field_c_1 = 1;
+}
+`,
+		"d.proto": `syntax = "proto3";
+
+message msg_d {
+  string field_d_1 = 1;
+}
+`,
+		"e.proto": `syntax = "proto3";
+
+message msg_e {
+  string field_e_1 = 1;
+}
+`,
+	}, "a.proto", "b.proto", "c.proto", "d.proto", "e.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 3)
+	assert.Equal(`syntax = "proto3";
+
+import "b.proto";
+
+import "c.proto";
+
+message msg_a {
+  msg_b field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Len(actualDesc[0].GetPublicDependencies(), 1)
+	assert.Equal("c.proto", actualDesc[0].GetPublicDependencies()[0].GetName())
+	assert.Equal(`syntax = "proto3";
+
+message msg_b {
+  string field_b_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+	assert.Equal("c.proto", actualDesc[2].GetName())
+}
+
+func TestImportsOfFilesNotFiltered(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - a.proto:
+    - msg_a
+    - svc_a
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto2";
+
+import public "b.proto";
+import weak "c.proto";
+import weak "d.proto";
+
+message msg_a {
+  optional msg_b field_a_1 = 1;
+
+  optional enum_b field_a_2 = 2;
+
+  optional msg_d field_a_3 = 3;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_b );
+}
+`,
+		"b.proto": `syntax = "proto2";
+
+message msg_b {
+  optional string field_b_1 = 1;
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+}
+`,
+		"c.proto": `syntax = "proto2";
+
+message msg_c {
+  optional string field_c_1 = 1;
+}
+`,
+		"d.proto": `syntax = "proto2";
+
+message msg_d {
+  optional string field_d_1 = 1;
+}
+`,
+	}, "a.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto2";
+
+import "b.proto";
+
+import "d.proto";
+
+message msg_a {
+  optional msg_b field_a_1 = 1;
+
+  optional enum_b field_a_2 = 2;
+
+  optional msg_d field_a_3 = 3;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_b );
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Len(actualDesc[0].GetPublicDependencies(), 1)
+	assert.Len(actualDesc[0].GetWeakDependencies(), 1)
+	assert.Equal("d.proto", actualDesc[0].GetWeakDependencies()[0].GetName())
+}
+
+func TestWellKnownTypesAreExternal(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+exclude:
+  - google/protobuf/timestamp.proto
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+import "google/protobuf/timestamp.proto";
+
+message msg_a {
+  google.protobuf.Timestamp field_a_1 = 1;
+}
+`)
+	inputDesc = append(inputDesc, inputDesc[0].GetDependencies()...)
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+import "google/protobuf/timestamp.proto";
+
+message msg_a {
+  google.protobuf.Timestamp field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestExternalDependencies(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+external:
+  files:
+    - vendor/*
+include:
+  - test.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"vendor/b.proto": `syntax = "proto3";
+
+package vendor;
+
+message msg_b {
+  string field_b_1 = 1;
+}
+`,
+		"test.proto": `syntax = "proto3";
+
+import "vendor/b.proto";
+
+message msg_a {
+  vendor.msg_b field_a_1 = 1;
+}
+`,
+	}, "test.proto", "vendor/b.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal("test.proto", actualDesc[0].GetName())
+	assert.Equal("vendor/b.proto", actualDesc[0].GetDependencies()[0].GetName())
+}
+
+func TestAlphabeticalOrdering(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+ordering: alphabetical
+include:
+  - test.proto
+`,
+		`syntax = "proto3";
+
+message msg_b {
+  string field_b_2 = 1;
+
+  string field_b_1 = 2;
+
+  message msg_b_2 {
+  }
+
+  message msg_b_1 {
+  }
+}
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+enum enum_b {
+  VALUE_B_1 = 0;
+
+  VALUE_B_0 = 1;
+}
+
+enum enum_a {
+  VALUE_A_0 = 0;
+}
+
+service svc_b {
+  rpc method_b_2 ( msg_a ) returns ( msg_a );
+
+  rpc method_b_1 ( msg_a ) returns ( msg_a );
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+message msg_b {
+  string field_b_1 = 2;
+
+  string field_b_2 = 1;
+
+  message msg_b_1 {
+  }
+
+  message msg_b_2 {
+  }
+}
+
+enum enum_a {
+  VALUE_A_0 = 0;
+}
+
+enum enum_b {
+  VALUE_B_1 = 0;
+
+  VALUE_B_0 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+}
+
+service svc_b {
+  rpc method_b_1 ( msg_a ) returns ( msg_a );
+
+  rpc method_b_2 ( msg_a ) returns ( msg_a );
+}
+`,
+	)
+}
+
+func TestAlphabeticalOrderingUsesRenamedNames(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+ordering: alphabetical
+include:
+  - test.proto
+renames:
+  - match:
+      name: msg_z
+    to: msg_a
+  - match:
+      name: field_z
+    to: field_a
+`,
+		`syntax = "proto3";
+
+message msg_b {
+  string field_b = 1;
+
+  string field_z = 2;
+}
+
+message msg_z {
+  string field_c = 1;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_c = 1;
+}
+
+message msg_b {
+  string field_a = 2 [json_name = "fieldZ"];
+
+  string field_b = 1;
+}
+`,
+	)
+}
+
+func TestOutputIsDeterministic(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - c.proto
+  - a.proto
+  - b.proto
+`)
+	files := map[string]string{
+		"options.proto": customOptionsFile,
+	}
+	paths := []string{}
+	for _, name := range []string{"c", "a", "b"} {
+		files[name+".proto"] = `syntax = "proto3";
+
+import "options.proto";
+
+message msg_` + name + ` {
+  option (acme.owner_team) = "` + name + `";
+
+  string field_1 = 1 [(acme.sensitive) = true];
+}
+`
+		paths = append(paths, name+".proto")
+	}
+	inputDesc := DescriptorSetFromFiles(assert, files, paths...)
+
+	var expected []string
+	for i := 0; i < 10; i++ {
+		actualDesc, err := FilterSet(inputDesc, parsedConfig)
+		assert.NoError(err)
+		actual := []string{}
+		for _, descriptor := range actualDesc {
+			actual = append(actual, descriptor.GetName()+"\n"+FileDescriptorToString(assert, descriptor))
+		}
+		if expected == nil {
+			expected = actual
+		}
+		assert.Equal(expected, actual)
+	}
+	assert.Equal("c.proto", inputDesc[0].GetName())
+	assert.True(strings.HasPrefix(expected[0], "c.proto\n"))
+}
+
+func TestPackageRename(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+packages:
+  - from: acme.internal
+    to: acme
+    options:
+      go_package: "github.com/acme/api/{{.PackagePath}};{{.PackageName}}"
+      java_package: "com.{{.Package}}"
+      csharp_namespace: "{{.PascalPackage}}"
+include:
+  - search.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"common.proto": `syntax = "proto3";
+
+package acme.internal.common;
+
+option go_package = "github.com/acme/internal/common";
+
+message Page {
+  int32 size = 1;
+}
+`,
+		"search.proto": `syntax = "proto3";
+
+package acme.internal.search.v1;
+
+import "common.proto";
+
+option go_package = "github.com/acme/internal/search/v1";
+
+message SearchRequest {
+  acme.internal.common.Page page = 1;
+}
+
+service SearchService {
+  rpc Search ( SearchRequest ) returns ( acme.internal.common.Page );
+}
+`,
+	}, "common.proto", "search.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal(`syntax = "proto3";
+
+package acme.common;
+
+option csharp_namespace = "Acme.Common";
+
+option go_package = "github.com/acme/api/acme/common;common";
+
+option java_package = "com.acme.common";
+
+message Page {
+  int32 size = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Equal(`syntax = "proto3";
+
+package acme.search.v1;
+
+import "common.proto";
+
+option csharp_namespace = "Acme.Search.V1";
+
+option go_package = "github.com/acme/api/acme/search/v1;v1";
+
+option java_package = "com.acme.search.v1";
+
+message SearchRequest {
+  acme.common.Page page = 1;
+}
+
+service SearchService {
+  rpc Search ( SearchRequest ) returns ( acme.common.Page );
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+}
+
+func TestPackageRenameOptionsReplacedByOptionRules(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+packages:
+  - from: acme.internal
+    to: acme
+    options:
+      go_package: "github.com/acme/api/{{.PackagePath}}"
+      java_package: "com.{{.Package}}"
+option_rules:
+  - match:
+      kind: file
+    set:
+      go_package: github.com/acme/public
+include:
+  - test.proto
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+package acme.internal;
+
+option go_package = "github.com/acme/internal";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+option go_package = "github.com/acme/public";
+
+option java_package = "com.acme";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	warnings := actualReport.OfKind(report.Warning)
+	assert.Len(warnings, 1)
+	assert.Equal("test.proto", warnings[0].Element)
+	assert.Equal("Option go_package set by the rename of package acme.internal is replaced by an option rule",
+		warnings[0].Message)
+}
+
+func TestPathRewrite(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+paths:
+  - prefix: acme/internal/
+    replacement: acme/
+include:
+  - acme/internal/search.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"acme/internal/common.proto": `syntax = "proto3";
+
+message Page {
+  int32 size = 1;
+}
+`,
+		"acme/internal/search.proto": `syntax = "proto3";
+
+import "acme/internal/common.proto";
+
+message SearchRequest {
+  Page page = 1;
+}
+`,
+	}, "acme/internal/common.proto", "acme/internal/search.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal("acme/common.proto", actualDesc[0].GetName())
+	assert.Equal("acme/search.proto", actualDesc[1].GetName())
+	assert.Equal(`syntax = "proto3";
+
+import "acme/common.proto";
+
+message SearchRequest {
+  Page page = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+}
+
+func TestPathRewriteCollision(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+paths:
+  - flatten: public
+include:
+  - a/test.proto
+  - b/test.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a/test.proto": `syntax = "proto3";
+
+package a;
+
+message msg_a {
+}
+`,
+		"b/test.proto": `syntax = "proto3";
+
+package b;
+
+message msg_b {
+}
+`,
+	}, "a/test.proto", "b/test.proto")
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "public/test.proto")
+}
+
+const substitutionInput = `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  msg_b internal_metadata = 7;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+`
+
+func TestSubstituteTypeByBytes(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+substitutions:
+  - match:
+      name: internal_metadata
+    type: bytes
+include:
+  - test.proto:
+    - msg_a
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", substitutionInput)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  bytes internal_metadata = 7;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Len(actualReport.OfKind(report.Warning), 0)
+}
+
+func TestSubstituteTypeByWellKnownTypes(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+substitutions:
+  - match:
+      name: internal_metadata
+    type: google.protobuf.Empty
+  - match:
+      type: msg_b
+    type: google.protobuf.Any
+include:
+  - test.proto:
+    - msg_a
+    - msg_c
+exclude:
+  - test.proto:
+    - msg_b
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", substitutionInput+`
+message msg_c {
+  msg_b field_c_1 = 1;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+import "google/protobuf/any.proto";
+
+import "google/protobuf/empty.proto";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  google.protobuf.Empty internal_metadata = 7;
+}
+
+message msg_c {
+  google.protobuf.Any field_c_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	warnings := actualReport.OfKind(report.Warning)
+	assert.Len(warnings, 1)
+	assert.Equal("msg_c.field_c_1", warnings[0].Element)
+}
+
+func TestSubstituteScalarIsWarned(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+substitutions:
+  - match:
+      type: int32
+    type: bytes
+include:
+  - test.proto
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  int32 field_a_1 = 1;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Len(actualReport.OfKind(report.Warning), 1)
+}
+
+func TestSubstituteByExcludedTypeFails(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+substitutions:
+  - match:
+      name: internal_metadata
+    type: Opaque
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - Opaque
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", substitutionInput+`
+message Opaque {
+}
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "msg_a.internal_metadata references Opaque that is excluded from the output")
+}
+
+var bundleInput = map[string]string{
+	"a.proto": `syntax = "proto3";
+
+package acme;
+
+import "b.proto";
+import "c.proto";
+import "google/protobuf/timestamp.proto";
+
+message msg_a {
+  msg_b field_a_1 = 1;
+
+  google.protobuf.Timestamp field_a_2 = 2;
+
+  vendor.msg_c field_a_3 = 3;
+}
+`,
+	"b.proto": `syntax = "proto3";
+
+package acme;
+
+import "c.proto";
+import "google/protobuf/timestamp.proto";
+
+message msg_b {
+  google.protobuf.Timestamp field_b_1 = 1;
+
+  vendor.msg_c field_b_2 = 2;
+}
+
+service svc_b {
+  rpc method_b ( msg_b ) returns ( msg_b );
+}
+`,
+	"c.proto": `syntax = "proto3";
+
+package vendor;
+
+message msg_c {
+  string field_c_1 = 1;
+}
+`,
+}
+
+func TestBundle(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: bundle
+  bundle: public/api.proto
+external:
+  files:
+    - c.proto
+include:
+  - a.proto
+  - b.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, bundleInput, "a.proto", "b.proto", "c.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal("public/api.proto", actualDesc[0].GetName())
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+import "c.proto";
+
+import "google/protobuf/timestamp.proto";
+
+message msg_a {
+  msg_b field_a_1 = 1;
+
+  google.protobuf.Timestamp field_a_2 = 2;
+
+  vendor.msg_c field_a_3 = 3;
+}
+
+message msg_b {
+  google.protobuf.Timestamp field_b_1 = 1;
+
+  vendor.msg_c field_b_2 = 2;
+}
+
+service svc_b {
+  rpc method_b ( msg_b ) returns ( msg_b );
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestBundleReconcilePackages(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: bundle
+include:
+  - a.proto
+  - b.proto
+  - c.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, bundleInput, "a.proto", "b.proto", "c.proto")
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "vendor")
+
+	parsedConfig = ConfFromString(assert, `---
+layout:
+  mode: bundle
+packages:
+  - from: vendor
+    to: acme
+include:
+  - a.proto
+  - b.proto
+  - c.proto
+`)
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal("bundle.proto", actualDesc[0].GetName())
+	assert.Equal("acme", actualDesc[0].GetPackage())
+	assert.Len(actualDesc[0].GetDependencies(), 1)
+	assert.NotNil(actualDesc[0].FindSymbol("acme.msg_c"))
+}
+
+func TestBundleNameCollision(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: bundle
+packages:
+  - from: a
+    to: acme
+  - from: b
+    to: acme
+include:
+  - a.proto
+  - b.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto3";
+
+package a;
+
+message msg_a {
+}
+`,
+		"b.proto": `syntax = "proto3";
+
+package b;
+
+message msg_a {
+}
+`,
+	}, "a.proto", "b.proto")
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "msg_a is defined in both a.proto and b.proto")
+}
+
+var layoutInput = map[string]string{
+	"a.proto": `syntax = "proto3";
+
+package acme.a;
+
+import "b.proto";
+
+message MsgA {
+  acme.b.MsgB field_a_1 = 1;
+
+  MsgA2 field_a_2 = 2;
+}
+
+message MsgA2 {
+  acme.b.EnumB field_a_2_1 = 1;
+}
+
+service SvcA {
+  rpc MethodA ( MsgA ) returns ( acme.b.MsgB );
+}
+`,
+	"b.proto": `syntax = "proto3";
+
+package acme.b;
+
+message MsgB {
+  string field_b_1 = 1;
+}
+
+enum EnumB {
+  ENUM_B_UNSPECIFIED = 0;
+}
+`,
+	"c.proto": `syntax = "proto3";
+
+package acme.a;
+
+message MsgC {
+  string field_c_1 = 1;
+}
+`,
+}
+
+func TestLayoutPackage(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: package
+include:
+  - a.proto
+  - b.proto
+  - c.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, layoutInput, "a.proto", "b.proto", "c.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal("acme/a.proto", actualDesc[0].GetName())
+	assert.Equal(`syntax = "proto3";
+
+package acme.a;
+
+import "acme/b.proto";
+
+message MsgA {
+  acme.b.MsgB field_a_1 = 1;
+
+  MsgA2 field_a_2 = 2;
+}
+
+message MsgA2 {
+  acme.b.EnumB field_a_2_1 = 1;
+}
+
+message MsgC {
+  string field_c_1 = 1;
+}
+
+service SvcA {
+  rpc MethodA ( MsgA ) returns ( acme.b.MsgB );
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Equal("acme/b.proto", actualDesc[1].GetName())
+}
+
+func TestLayoutType(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: type
+include:
+  - a.proto
+  - b.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, layoutInput, "a.proto", "b.proto", "c.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+
+	names := []string{}
+	for _, descriptor := range actualDesc {
+		names = append(names, descriptor.GetName())
+	}
+	assert.Equal([]string{
+		"acme/a/msg_a.proto",
+		"acme/a/msg_a2.proto",
+		"acme/a/svc_a.proto",
+		"acme/b/msg_b.proto",
+		"acme/b/enum_b.proto",
+	}, names)
+
+	assert.Equal(`syntax = "proto3";
+
+package acme.a;
+
+import "acme/a/msg_a2.proto";
+
+import "acme/b/msg_b.proto";
+
+message MsgA {
+  acme.b.MsgB field_a_1 = 1;
+
+  MsgA2 field_a_2 = 2;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Equal(`syntax = "proto3";
+
+package acme.a;
+
+import "acme/a/msg_a.proto";
+
+import "acme/b/msg_b.proto";
+
+service SvcA {
+  rpc MethodA ( MsgA ) returns ( acme.b.MsgB );
+}
+`, FileDescriptorToString(assert, actualDesc[2]))
+}
+
+func TestLayoutTypeRecursiveMessages(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+layout:
+  mode: type
+include:
+  - test.proto
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  msg_b field_a_1 = 1;
+}
+
+message msg_b {
+  msg_a field_b_1 = 1;
+}
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "cyclic dependency")
+}
+
+func TestOptionRules(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+option_rules:
+  - match:
+      kind: message
+    strip:
+      - (acme.owner_team)
+  - match:
+      name: legacy_*
+    set:
+      deprecated: true
+  - match:
+      kind: field
+      type: bytes
+    set:
+      (acme.sensitive): true
+  - match:
+      kind: file
+    strip:
+      - java_*
+    set:
+      go_package: github.com/acme/public
+      optimize_for: CODE_SIZE
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"options.proto": customOptionsFile,
+		"test.proto": `syntax = "proto3";
+
+import "options.proto";
+
+option java_package = "com.acme";
+
+option go_package = "github.com/acme/internal";
+
+message msg_a {
+  option (acme.owner_team) = "search";
+
+  string field_a_1 = 1;
+
+  int32 legacy_field_a_2 = 2;
+
+  bytes field_a_3 = 3;
+}
+
+enum legacy_enum_b {
+  VALUE_B_0 = 0;
+}
+`,
+	}, "test.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+import "options.proto";
+
+option go_package = "github.com/acme/public";
+
+option optimize_for = CODE_SIZE;
+
+message msg_a {
+  string field_a_1 = 1;
+
+  int32 legacy_field_a_2 = 2 [deprecated = true];
+
+  bytes field_a_3 = 3 [(acme.sensitive) = true];
+}
+
+enum legacy_enum_b {
+  option deprecated = true;
+
+  VALUE_B_0 = 0;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
+
+func TestOptionRulesInvalidValue(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+option_rules:
+  - match:
+      kind: message
+    set:
+      deprecated: "yes"
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "deprecated")
+}
+
+func TestOptionRulesUnknownCustomOption(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+option_rules:
+  - match:
+      kind: message
+    set:
+      (acme.unknown): true
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Equal(`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	warnings := actualReport.OfKind(report.Warning)
+	assert.Len(warnings, 1)
+	assert.Equal("msg_a", warnings[0].Element)
+	assert.Contains(warnings[0].Message, "acme.unknown")
+}
+
+func TestCommentTransforms(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+comments:
+  strip_detached: true
+  transforms:
+    - drop_paragraph: "INTERNAL:"
+    - drop_line: "TODO"
+    - replace: '[a-z0-9-]+\.corp\.acme\.com'
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+// Detached comment of msg_a
+
+// Comment of msg_a
+// TODO(alice): hack
+message msg_a {
+  // Comment of field_a_1
+  //
+  // INTERNAL: Filled by search-1.corp.acme.com
+  string field_a_1 = 1; // Trailing comment of field_a_1
+
+  // TODO: Remove
+  string field_a_2 = 2; // Served by search-2.corp.acme.com
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+// Comment of msg_a
+message msg_a {
+  // Comment of field_a_1
+  string field_a_1 = 1; // Trailing comment of field_a_1
+
+  string field_a_2 = 2; // Served by [redacted]
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	redactions := actualReport.OfKind(report.Redaction)
+	assert.Len(redactions, 4)
+	assert.Equal("msg_a", redactions[0].Element)
+	assert.Equal("Dropped a line matching 'TODO'", redactions[0].Message)
+	assert.Equal("msg_a.field_a_1", redactions[1].Element)
+	assert.Equal("Dropped a paragraph matching 'INTERNAL:'", redactions[1].Message)
+	assert.Equal("msg_a.field_a_2", redactions[2].Element)
+	assert.Equal("msg_a.field_a_2", redactions[3].Element)
+}
+
+func TestCommentsStrip(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+include:
+  - test.proto
+comments:
+  strip: true
+`,
+		`syntax = "proto3";
+
+// Comment of msg_a
+message msg_a {
+  // Comment of field_a_1
+  string field_a_1 = 1; // Trailing comment of field_a_1
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+`,
+	)
+}
+
+func TestRenames(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - a.proto
+  - b.proto
+renames:
+  - match:
+      path: a.proto/msg_a/internal_id
+    to: id
+  - match:
+      kind: message
+    regex: '^Internal(\w+)$'
+    replacement: '${1}'
+  - match:
+      kind: enum_value
+      name: VALUE_B_HACK
+    to: VALUE_B_1
+  - match:
+      kind: method
+      name: DoInternalStuff
+    to: DoStuff
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto2";
+
+message msg_a {
+  optional string internal_id = 1;
+
+  optional InternalItem field_a_2 = 2;
+
+  map<string, InternalItem> field_a_3 = 3;
+
+  optional enum_b field_a_4 = 4 [default = VALUE_B_HACK];
+
+  message InternalItem {
+    optional string field_item_1 = 1;
+  }
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_HACK = 1;
+}
+`,
+		"b.proto": `syntax = "proto2";
+
+import "a.proto";
+
+service svc_b {
+  rpc DoInternalStuff ( msg_a.InternalItem ) returns ( msg_a );
+}
+`,
+	}, "a.proto", "b.proto")
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal(`syntax = "proto2";
+
+message msg_a {
+  optional string id = 1 [json_name = "internalId"];
+
+  optional Item field_a_2 = 2;
+
+  map<string, Item> field_a_3 = 3;
+
+  optional enum_b field_a_4 = 4 [default = VALUE_B_1];
+
+  message Item {
+    optional string field_item_1 = 1;
+  }
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Equal(`syntax = "proto2";
+
+import "a.proto";
+
+service svc_b {
+  rpc DoStuff ( msg_a.Item ) returns ( msg_a );
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+
+	renames := actualReport.OfKind(report.Rename)
+	assert.Len(renames, 4)
+	assert.Equal("msg_a.internal_id", renames[2].Element)
+	assert.Equal("Renamed to id, keeping internalId as JSON name", renames[2].Message)
+	assert.Len(actualReport.OfKind(report.Warning), 2)
+}
+
+func TestRenameGroupFails(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+renames:
+  - match:
+      name: Item
+    to: Entry
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto2";
+
+message msg_a {
+  repeated group Item = 1 {
+    optional string field_item_1 = 2;
+  }
+}
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "Groups can't be renamed")
+}
+
+func TestRenameToInvalidNameFails(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+renames:
+  - match:
+      kind: field
+    regex: '^internal_'
+    replacement: '1_'
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  string internal_id = 1;
+}
+`)
+	_, err := FilterSet(inputDesc, parsedConfig)
+	assert.Error(err)
+	assert.Contains(err.Error(), "msg_a.internal_id")
+	assert.Contains(err.Error(), "'1_id' that isn't a valid identifier")
+}
+
+func TestContainerWithoutHoisting(t *testing.T) {
+	runSimpleTest(
+		t,
+		`---
+reserve_removed: true
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  msg_b.msg_b_a field_a_1 = 1;
+}
+
+// The container
+message msg_b {
+  option deprecated = true;
+
+  message msg_b_a {
+    string field_b_a_1 = 1;
+  }
+
+  string field_b_1 = 1;
+
+  reserved 2;
+}
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  msg_b.msg_b_a field_a_1 = 1;
+}
+
+// The container
+message msg_b {
+  option deprecated = true;
+
+  message msg_b_a {
+    string field_b_a_1 = 1;
+  }
+
+  reserved 2;
+}
+`,
+	)
+}
+
+func TestHoisting(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+hoisting:
+  enabled: true
+include:
+  - test.proto:
+    - msg_a
+    - Item
+`)
+	inputDesc := DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+  Internal.Item field_a_1 = 1;
+
+  Internal.Status field_a_2 = 2;
+
+  Internal.Nested.Detail field_a_3 = 3;
+}
+
+message Item {
+  string field_item_1 = 1;
+}
+
+message Internal {
+  message Item {
+    string field_internal_item_1 = 1;
+
+    Status field_internal_item_2 = 2;
+  }
+
+  enum Status {
+    STATUS_UNKNOWN = 0;
+  }
+
+  message Nested {
+    message Detail {
+      string field_detail_1 = 1;
+    }
+  }
+
+  string field_internal_1 = 1;
+}
+`)
+	actualDesc, actualReport, err := FilterSetWithReport(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+message msg_a {
+  InternalItem field_a_1 = 1;
+
+  Status field_a_2 = 2;
+
+  Detail field_a_3 = 3;
+}
+
+message Item {
+  string field_item_1 = 1;
+}
+
+message InternalItem {
+  string field_internal_item_1 = 1;
+
+  Status field_internal_item_2 = 2;
+}
+
+message Detail {
+  string field_detail_1 = 1;
+}
+
+enum Status {
+  STATUS_UNKNOWN = 0;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+
+	hoisted := actualReport.OfKind(report.Hoist)
+	assert.Len(hoisted, 3)
+	assert.Equal("Internal.Item", hoisted[0].Element)
+	assert.Equal("Hoisted to the top level of test.proto as InternalItem", hoisted[0].Message)
+}
+
+func TestHoistingToFile(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+hoisting:
+  enabled: true
+  file: b.proto
+include:
+  - a.proto
+  - b.proto
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto3";
+
+package acme;
+
+import "c.proto";
+
+message msg_a {
+  internal.Container.Item field_a_1 = 1;
+}
+`,
+		"b.proto": `syntax = "proto3";
+
+package acme;
+
+message msg_b {
+}
+`,
+		"c.proto": `syntax = "proto3";
+
+package internal;
+
+message Container {
+  message Item {
+    string field_item_1 = 1;
+  }
+}
+`,
+	}, "a.proto", "b.proto", "c.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+import "b.proto";
+
+message msg_a {
+  Item field_a_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+message msg_b {
+}
+
+message Item {
+  string field_item_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+}
+
+func TestHoistingNameTakenInPackage(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+hoisting:
+  enabled: true
+include:
+  - a.proto
+  - b.proto:
+    - msg_b
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"a.proto": `syntax = "proto3";
+
+package acme;
+
+message Inner {
+  string field_inner_1 = 1;
+}
+`,
+		"b.proto": `syntax = "proto3";
+
+package acme;
+
+message msg_b {
+  Outer.Inner field_b_1 = 1;
+}
+
+message Outer {
+  message Inner {
+    string field_outer_inner_1 = 1;
+  }
+
+  string field_outer_1 = 1;
+}
+`,
+	}, "a.proto", "b.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 2)
+	assert.Equal(`syntax = "proto3";
+
+package acme;
+
+message msg_b {
+  OuterInner field_b_1 = 1;
+}
+
+message OuterInner {
+  string field_outer_inner_1 = 1;
+}
+`, FileDescriptorToString(assert, actualDesc[1]))
+}
+
+func TestDeprecations(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := ConfFromString(assert, `---
+include:
+  - test.proto
+deprecations:
+  - match:
+      path: test.proto/msg_a/field_a_2
+    notice: "Deprecated: will be removed after 2027-01"
+  - match:
+      kind: enum_value
+      name: VALUE_B_1
+  - match:
+      kind: method
+      name: Legacy*
+    notice: |-
+      Deprecated: use Search instead.
+      Will be removed after 2027-01.
+`)
+	inputDesc := DescriptorSetFromFiles(assert, map[string]string{
+		"test.proto": `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  // The legacy identifier
+  int32 field_a_2 = 2;
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1;
+}
+
+service Service {
+  rpc Search ( msg_a ) returns ( msg_a );
+
+  rpc LegacySearch ( msg_a ) returns ( msg_a );
+}
+`,
+	}, "test.proto")
+	actualDesc, err := FilterSet(inputDesc, parsedConfig)
+	assert.NoError(err)
+	assert.Len(actualDesc, 1)
+	assert.Equal(`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  // Deprecated: will be removed after 2027-01
+  //
+  // The legacy identifier
+  int32 field_a_2 = 2 [deprecated = true];
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+
+  VALUE_B_1 = 1 [deprecated = true];
+}
+
+service Service {
+  rpc Search ( msg_a ) returns ( msg_a );
+
+  // Deprecated: use Search instead.
+  // Will be removed after 2027-01.
+  rpc LegacySearch ( msg_a ) returns ( msg_a ) {
+    option deprecated = true;
+  }
+}
+`, FileDescriptorToString(assert, actualDesc[0]))
+}
@@ -38,6 +38,25 @@ func LoadProtoSet(path string) (*desc.FileDescriptor, error) {
 	return desc.CreateFileDescriptorFromSet(fds)
 }
 
+// LoadProtoSetFiles load every file of a file descriptor set, in the order of the set
+func LoadProtoSetFiles(path string) ([]*desc.FileDescriptor, error) {
+	fds, err := loadFileDescriptorSet(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := desc.CreateFileDescriptorsFromSet(fds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*desc.FileDescriptor{}
+	for _, file := range fds.GetFile() {
+		result = append(result, files[file.GetName()])
+	}
+	return result, nil
+}
+
 func OutputSet(set []*desc.FileDescriptor) {
 	printer := protoprint.Printer{}
 	printer.PrintProtosToFileSystem(set, "./out")
@@ -1,6 +1,7 @@
 package builderutil
 
 import (
+	"github.com/golang/protobuf/proto"
 	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/builder"
@@ -40,5 +41,26 @@ func SetAllComments(fileBuilder *builder.FileBuilder, descriptor *desc.FileDescr
 func SetFileBasicInfo(fileBuilder *builder.FileBuilder, descriptor *desc.FileDescriptor) {
 	fileBuilder.IsProto3 = descriptor.IsProto3()
 	fileBuilder.Package = descriptor.GetPackage()
-	fileBuilder.Options = descriptor.GetFileOptions()
+}
+
+// SetOptions set the options of any builder, options of the wrong type are ignored
+func SetOptions(b builder.Builder, options proto.Message) {
+	switch typed := b.(type) {
+	case *builder.FileBuilder:
+		typed.Options, _ = options.(*dpb.FileOptions)
+	case *builder.MessageBuilder:
+		typed.Options, _ = options.(*dpb.MessageOptions)
+	case *builder.FieldBuilder:
+		typed.Options, _ = options.(*dpb.FieldOptions)
+	case *builder.OneOfBuilder:
+		typed.Options, _ = options.(*dpb.OneofOptions)
+	case *builder.EnumBuilder:
+		typed.Options, _ = options.(*dpb.EnumOptions)
+	case *builder.EnumValueBuilder:
+		typed.Options, _ = options.(*dpb.EnumValueOptions)
+	case *builder.ServiceBuilder:
+		typed.Options, _ = options.(*dpb.ServiceOptions)
+	case *builder.MethodBuilder:
+		typed.Options, _ = options.(*dpb.MethodOptions)
+	}
 }
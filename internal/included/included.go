@@ -7,11 +7,14 @@ package included
 
 import (
 	"fmt"
-	"strings"
 
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/selector"
+	"github.com/vbfox/proto-filter/internal/substitution"
 	"github.com/vbfox/proto-filter/internal/utils"
+	"github.com/vbfox/proto-filter/report"
 )
 
 type inclusionType int
@@ -21,6 +24,11 @@ const (
 	inclusionTypeIncludedImplicit
 	inclusionTypeIncludedExplicit
 	inclusionTypeExcludedExplicit
+	// inclusionTypeIncludedContainer is used for parents of referenced elements, they are kept to contain the element
+	// but none of their content is included
+	inclusionTypeIncludedContainer
+	// inclusionTypeExcludedCascade is used for elements excluded because they reference an excluded type
+	inclusionTypeExcludedCascade
 )
 
 func (s inclusionType) String() string {
@@ -29,13 +37,22 @@ func (s inclusionType) String() string {
 		"inclusionType_included_implicit",
 		"inclusionType_included_explicit",
 		"inclusionType_excluded_explicit",
+		"inclusionType_included_container",
+		"inclusionType_excluded_cascade",
 	}[s]
 }
 
 type filterBuilder struct {
+	descriptors     []*desc.FileDescriptor
 	configuration   *configuration.Configuration
 	isIncludedCache map[string]configuration.InclusionResult
 	inclusionMap    map[string]inclusionType
+	report          *report.Report
+	// pathAliases contains alternative paths that the configuration can use for an element, like oneof members that
+	// can be reached both via their oneof and directly from their message
+	pathAliases map[string][]string
+	// selectorExclusions contains the paths excluded by selectors, they win over the include list of the configuration
+	selectorExclusions map[string]bool
 }
 
 func (b *filterBuilder) getInclusion(path string) inclusionType {
@@ -46,19 +63,34 @@ func (b *filterBuilder) getInclusion(path string) inclusionType {
 	return existingValue
 }
 
-// getIsIncludedFromCache returns how the configuration see the file
-func (b *filterBuilder) getIsIncludedFromCache(path string) configuration.InclusionResult {
-	existing, ok := b.isIncludedCache[path]
+// getIsIncludedFromCache returns how the configuration see the file, the path is kept as a slice as file names can
+// contain slashes
+func (b *filterBuilder) getIsIncludedFromCache(path []string) configuration.InclusionResult {
+	pathString := utils.BuildPath(path)
+	existing, ok := b.isIncludedCache[pathString]
 	if ok {
 		return existing
 	}
 
-	value := b.configuration.IsIncluded(strings.Split(path, "/")...)
-	b.isIncludedCache[path] = value
+	value := b.configuration.IsIncluded(path...)
+	alias, hasAlias := b.pathAliases[pathString]
+	// Selectors exclude oneof members by their message path, they also win when the oneof path is included
+	if b.selectorExclusions[pathString] || (hasAlias && b.selectorExclusions[utils.BuildPath(alias)]) {
+		value = configuration.Excluded
+	}
+	if hasAlias && value == configuration.UnknownInclusion {
+		value = b.getIsIncludedFromCache(alias)
+	}
+	b.isIncludedCache[pathString] = value
 	return value
 }
 
 func isIncluded(v inclusionType) bool {
+	return v == inclusionTypeIncludedImplicit || v == inclusionTypeIncludedExplicit || v == inclusionTypeIncludedContainer
+}
+
+// isExplored returns true if the children of the element have already been visited
+func isExplored(v inclusionType) bool {
 	return v == inclusionTypeIncludedImplicit || v == inclusionTypeIncludedExplicit
 }
 
@@ -70,10 +102,11 @@ type inclusionComputationResult struct {
 	childInclude        bool
 }
 
-func (b *filterBuilder) computeInclusionType(pathString string, fullyQualifiedName string, includedByParent bool) (inclusionComputationResult, error) {
+func (b *filterBuilder) computeInclusionType(path []string, fullyQualifiedName string, includedByParent bool) (inclusionComputationResult, error) {
 	result := inclusionComputationResult{}
 
-	configuredInclusion := b.getIsIncludedFromCache(pathString)
+	pathString := utils.BuildPath(path)
+	configuredInclusion := b.getIsIncludedFromCache(path)
 	existingValue := b.getInclusion(fullyQualifiedName)
 
 	result.configuredInclusion = configuredInclusion
@@ -100,7 +133,7 @@ func (b *filterBuilder) computeInclusionType(pathString string, fullyQualifiedNa
 		}
 
 		result.newValue = inclusionTypeIncludedExplicit
-		result.needToBeExplored = !isIncluded(existingValue)
+		result.needToBeExplored = !isExplored(existingValue)
 		return result, nil
 	}
 
@@ -114,7 +147,7 @@ func (b *filterBuilder) computeInclusionType(pathString string, fullyQualifiedNa
 		} else {
 			result.newValue = inclusionTypeIncludedImplicit
 		}
-		result.needToBeExplored = !isIncluded(existingValue)
+		result.needToBeExplored = !isExplored(existingValue)
 		return result, nil
 	}
 
@@ -124,8 +157,7 @@ func (b *filterBuilder) computeInclusionType(pathString string, fullyQualifiedNa
 }
 
 func (b *filterBuilder) includeAny(path []string, fullyQualifiedName string, includedByParent bool) (bool, bool, error) {
-	pathString := utils.BuildPath(path)
-	result, err := b.computeInclusionType(pathString, fullyQualifiedName, includedByParent)
+	result, err := b.computeInclusionType(path, fullyQualifiedName, includedByParent)
 	if err != nil {
 		return false, false, err
 	}
@@ -158,36 +190,202 @@ func getDescriptorPath(descriptor desc.Descriptor) []string {
 	return result
 }
 
+// includeParents mark the parents of a referenced element as containers so that the element has somewhere to live in
+// the output
+func (b *filterBuilder) includeParents(descriptor desc.Descriptor) {
+	for parent := descriptor.GetParent(); parent != nil; parent = parent.GetParent() {
+		fullyQualifiedName := parent.GetFullyQualifiedName()
+		if b.getInclusion(fullyQualifiedName) == inclusionTypeUnknown {
+			b.inclusionMap[fullyQualifiedName] = inclusionTypeIncludedContainer
+		}
+	}
+}
+
+// isExternal returns true if the element is part of an external dependency, these are never filtered
+func (b *filterBuilder) isExternal(descriptor desc.Descriptor) bool {
+	file := descriptor.GetFile()
+	return b.configuration.External.IsExternal(file.GetName(), file.GetPackage())
+}
+
+func (b *filterBuilder) includeReferencedType(descriptor desc.Descriptor, includedByParent bool) error {
+	if b.isExternal(descriptor) {
+		// Only referenced via an import
+		return nil
+	}
+
+	var err error
+	switch typed := descriptor.(type) {
+	case *desc.MessageDescriptor:
+		err = b.includeMessage(typed, getDescriptorPath(typed), includedByParent)
+	case *desc.EnumDescriptor:
+		err = b.includeEnum(typed, getDescriptorPath(typed), includedByParent)
+	}
+	if err != nil {
+		return err
+	}
+
+	if isIncluded(b.getInclusion(descriptor.GetFullyQualifiedName())) {
+		b.includeParents(descriptor)
+	}
+
+	return nil
+}
+
+// getFieldReferencedTypes returns the messages and enums that a field need to exist in the output
+func getFieldReferencedTypes(descriptor *desc.FieldDescriptor) []desc.Descriptor {
+	if descriptor.IsMap() {
+		keyTypes := getFieldReferencedTypes(descriptor.GetMapKeyType())
+		valueTypes := getFieldReferencedTypes(descriptor.GetMapValueType())
+		return append(keyTypes, valueTypes...)
+	}
+
+	if messageType := descriptor.GetMessageType(); messageType != nil {
+		return []desc.Descriptor{messageType}
+	}
+
+	if enumType := descriptor.GetEnumType(); enumType != nil {
+		return []desc.Descriptor{enumType}
+	}
+
+	return []desc.Descriptor{}
+}
+
+func getMethodReferencedTypes(descriptor *desc.MethodDescriptor) []desc.Descriptor {
+	return []desc.Descriptor{descriptor.GetInputType(), descriptor.GetOutputType()}
+}
+
+// isExcludedByConfiguration returns true if the element or any of its parents is excluded by the configuration
+func (b *filterBuilder) isExcludedByConfiguration(descriptor desc.Descriptor) bool {
+	path := append(getDescriptorPath(descriptor), descriptor.GetName())
+	for i := 1; i <= len(path); i++ {
+		if b.getIsIncludedFromCache(path[:i]) == configuration.Excluded {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *filterBuilder) findExcludedType(types []desc.Descriptor) desc.Descriptor {
+	for _, t := range types {
+		if b.isExcludedByConfiguration(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+// excludeByCascade handle an element referencing an excluded type, it's excluded if it would have been included
+// otherwise
+func (b *filterBuilder) excludeByCascade(path []string, descriptor desc.Descriptor, excludedType desc.Descriptor, includedByParent bool) error {
+	fullyQualifiedName := descriptor.GetFullyQualifiedName()
+	result, err := b.computeInclusionType(path, fullyQualifiedName, includedByParent)
+	if err != nil {
+		return err
+	}
+
+	if !isIncluded(result.newValue) {
+		b.inclusionMap[fullyQualifiedName] = result.newValue
+		return nil
+	}
+
+	if result.existingValue != inclusionTypeExcludedCascade {
+		b.report.Add(report.CascadedRemoval, fullyQualifiedName, "Removed because it references the excluded type %s",
+			excludedType.GetFullyQualifiedName())
+	}
+	b.inclusionMap[fullyQualifiedName] = inclusionTypeExcludedCascade
+	return nil
+}
+
+// getSubstitutedReferencedTypes returns the types a field references once its type substitution is applied
+func (b *filterBuilder) getSubstitutedReferencedTypes(descriptor *desc.FieldDescriptor) ([]desc.Descriptor, error) {
+	typeSubstitution, err := substitution.Find(b.configuration, descriptor)
+	if err != nil || typeSubstitution == nil {
+		return getFieldReferencedTypes(descriptor), err
+	}
+
+	if typeSubstitution.Type == configuration.SubstituteBytes {
+		return []desc.Descriptor{}, nil
+	}
+
+	message, err := substitution.ResolveMessage(b.descriptors, typeSubstitution.Type)
+	if err != nil {
+		return nil, err
+	}
+	return []desc.Descriptor{message}, nil
+}
+
 func (b *filterBuilder) includeField(descriptor *desc.FieldDescriptor, path []string, includedByParent bool) error {
 	currentPath := append(path, descriptor.GetName())
+	referencedTypes, err := b.getSubstitutedReferencedTypes(descriptor)
+	if err != nil {
+		return fmt.Errorf("Failed to substitute the type of field %s: %w", currentPath, err)
+	}
+
+	if b.configuration.CascadeExclusions {
+		if excludedType := b.findExcludedType(referencedTypes); excludedType != nil {
+			return b.excludeByCascade(currentPath, descriptor, excludedType, includedByParent)
+		}
+	}
+
 	ok, childInclude, err := b.includeAny(currentPath, descriptor.GetFullyQualifiedName(), includedByParent)
 	if !ok {
 		return err
 	}
 
-	messageType := descriptor.GetMessageType()
-	if messageType != nil {
-		if messageType.IsMapEntry() {
-			keyMessage := descriptor.GetMapKeyType().GetMessageType()
-			if keyMessage != nil {
-				err = b.includeMessage(keyMessage, getDescriptorPath(keyMessage), childInclude)
-			}
-			if err == nil {
-				valueMessage := descriptor.GetMapValueType().GetMessageType()
-				err = b.includeMessage(valueMessage, getDescriptorPath(valueMessage), childInclude)
-			}
-		} else {
-			err = b.includeMessage(messageType, getDescriptorPath(messageType), childInclude)
+	for _, referencedType := range referencedTypes {
+		if err := b.includeReferencedType(referencedType, childInclude); err != nil {
+			return fmt.Errorf("Failed to include field %s: %w", currentPath, err)
 		}
 	}
 
-	if err != nil {
-		return fmt.Errorf("Failed to include field %s: %w", currentPath, err)
+	return nil
+}
+
+// includeExtension handle an extension, it's removed if the message it extends is excluded and otherwise the extended
+// message is included with it
+func (b *filterBuilder) includeExtension(descriptor *desc.FieldDescriptor, path []string, includedByParent bool) error {
+	currentPath := append(path, descriptor.GetName())
+	extendee := descriptor.GetOwner()
+
+	if b.isExcludedByConfiguration(extendee) {
+		return b.excludeByCascade(currentPath, descriptor, extendee, includedByParent)
+	}
+
+	referencedTypes := getFieldReferencedTypes(descriptor)
+	if b.configuration.CascadeExclusions {
+		if excludedType := b.findExcludedType(referencedTypes); excludedType != nil {
+			return b.excludeByCascade(currentPath, descriptor, excludedType, includedByParent)
+		}
+	}
+
+	ok, childInclude, err := b.includeAny(currentPath, descriptor.GetFullyQualifiedName(), includedByParent)
+	if !ok {
+		return err
+	}
+
+	for _, referencedType := range append(referencedTypes, extendee) {
+		if err := b.includeReferencedType(referencedType, childInclude); err != nil {
+			return fmt.Errorf("Failed to include extension %s: %w", currentPath, err)
+		}
 	}
 
 	return nil
 }
 
+// IsGroupMessage returns true for the messages defined by a group field of their parent
+func IsGroupMessage(descriptor *desc.MessageDescriptor) bool {
+	parent, isMessage := descriptor.GetParent().(*desc.MessageDescriptor)
+	if !isMessage {
+		return false
+	}
+	for _, field := range parent.GetFields() {
+		if field.GetType() == dpb.FieldDescriptorProto_TYPE_GROUP && field.GetMessageType() == descriptor {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *filterBuilder) includeMessage(descriptor *desc.MessageDescriptor, path []string, includedByParent bool) error {
 	currentPath := append(path, descriptor.GetName())
 
@@ -203,6 +401,10 @@ func (b *filterBuilder) includeMessage(descriptor *desc.MessageDescriptor, path
 	}
 
 	for _, message := range descriptor.GetNestedMessageTypes() {
+		if IsGroupMessage(message) {
+			// Only included with their group field
+			continue
+		}
 		if err := b.includeMessage(message, currentPath, childInclude); err != nil {
 			return err
 		}
@@ -214,12 +416,139 @@ func (b *filterBuilder) includeMessage(descriptor *desc.MessageDescriptor, path
 		}
 	}
 
+	for _, oneOf := range descriptor.GetOneOfs() {
+		if err := b.includeOneOf(oneOf, currentPath, childInclude); err != nil {
+			return err
+		}
+	}
+
 	for _, field := range descriptor.GetFields() {
+		if field.GetOneOf() != nil {
+			// Handled with their oneof
+			continue
+		}
 		if err := b.includeField(field, currentPath, childInclude); err != nil {
 			return err
 		}
 	}
 
+	for _, extension := range descriptor.GetNestedExtensions() {
+		if err := b.includeExtension(extension, currentPath, childInclude); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// includeOneOf handle a oneof and its members, members can be selected either as children of the oneof or directly as
+// children of the message
+func (b *filterBuilder) includeOneOf(descriptor *desc.OneOfDescriptor, path []string, includedByParent bool) error {
+	currentPath := append(path, descriptor.GetName())
+	pathString := utils.BuildPath(currentPath)
+	fullyQualifiedName := descriptor.GetFullyQualifiedName()
+
+	_, childInclude, err := b.includeAny(currentPath, fullyQualifiedName, includedByParent)
+	if err != nil {
+		return err
+	}
+
+	if b.getInclusion(fullyQualifiedName) == inclusionTypeExcludedExplicit {
+		return nil
+	}
+
+	anyChoiceIncluded := false
+	for _, field := range descriptor.GetChoices() {
+		alias := append(append([]string{}, path...), field.GetName())
+		b.pathAliases[utils.PathConcat(pathString, field.GetName())] = alias
+		if err := b.includeField(field, currentPath, childInclude); err != nil {
+			return err
+		}
+		anyChoiceIncluded = anyChoiceIncluded || isIncluded(b.getInclusion(field.GetFullyQualifiedName()))
+	}
+
+	if anyChoiceIncluded && !isIncluded(b.getInclusion(fullyQualifiedName)) {
+		b.inclusionMap[fullyQualifiedName] = inclusionTypeIncludedImplicit
+	}
+
+	return nil
+}
+
+// applyOneOfPolicy handle the oneofs of included messages that lost members and ended up with one or zero member
+func (b *filterBuilder) applyOneOfPolicy(descriptor *desc.MessageDescriptor) error {
+	for _, message := range descriptor.GetNestedMessageTypes() {
+		if err := b.applyOneOfPolicy(message); err != nil {
+			return err
+		}
+	}
+
+	// Containers never appear with their content, their oneofs don't matter
+	inclusion := b.getInclusion(descriptor.GetFullyQualifiedName())
+	if !isIncluded(inclusion) || inclusion == inclusionTypeIncludedContainer {
+		return nil
+	}
+
+	for _, oneOf := range descriptor.GetOneOfs() {
+		if b.getInclusion(oneOf.GetFullyQualifiedName()) == inclusionTypeExcludedExplicit {
+			// The whole oneof was removed on purpose
+			continue
+		}
+
+		choices := oneOf.GetChoices()
+		includedChoices := []*desc.FieldDescriptor{}
+		for _, field := range choices {
+			if isIncluded(b.getInclusion(field.GetFullyQualifiedName())) {
+				includedChoices = append(includedChoices, field)
+			}
+		}
+
+		if len(includedChoices) == len(choices) || len(includedChoices) > 1 {
+			continue
+		}
+
+		switch b.configuration.OneOfPolicy {
+		case configuration.OneOfPolicyError:
+			return fmt.Errorf("Oneof %s has %d member(s) left after filtering", oneOf.GetFullyQualifiedName(),
+				len(includedChoices))
+		case configuration.OneOfPolicyDrop:
+			for _, field := range includedChoices {
+				b.inclusionMap[field.GetFullyQualifiedName()] = inclusionTypeExcludedExplicit
+			}
+			b.inclusionMap[oneOf.GetFullyQualifiedName()] = inclusionTypeExcludedExplicit
+		}
+	}
+
+	return nil
+}
+
+// checkRequiredFields detect proto2 required fields excluded from included messages, as messages without them can't
+// be parsed by consumers of the original schema
+func (b *filterBuilder) checkRequiredFields(descriptor *desc.MessageDescriptor) error {
+	for _, message := range descriptor.GetNestedMessageTypes() {
+		if err := b.checkRequiredFields(message); err != nil {
+			return err
+		}
+	}
+
+	// Containers never appear with their content, their fields don't matter
+	inclusion := b.getInclusion(descriptor.GetFullyQualifiedName())
+	if !isIncluded(inclusion) || inclusion == inclusionTypeIncludedContainer {
+		return nil
+	}
+
+	for _, field := range descriptor.GetFields() {
+		if !field.IsRequired() || isIncluded(b.getInclusion(field.GetFullyQualifiedName())) {
+			continue
+		}
+
+		if !b.configuration.AllowRequiredFieldRemoval {
+			return fmt.Errorf("Required field %s is excluded, this breaks wire compatibility",
+				field.GetFullyQualifiedName())
+		}
+
+		b.report.Add(report.Warning, field.GetFullyQualifiedName(), "Required field removed")
+	}
+
 	return nil
 }
 
@@ -247,21 +576,23 @@ func (b *filterBuilder) includeEnum(descriptor *desc.EnumDescriptor, path []stri
 
 func (b *filterBuilder) includeServiceMethod(descriptor *desc.MethodDescriptor, path []string, includedByParent bool) error {
 	currentPath := append(path, descriptor.GetName())
-	ok, childInclude, err := b.includeAny(currentPath, descriptor.GetFullyQualifiedName(), includedByParent)
-	if !ok {
-		return err
+	referencedTypes := getMethodReferencedTypes(descriptor)
+
+	if b.configuration.CascadeExclusions {
+		if excludedType := b.findExcludedType(referencedTypes); excludedType != nil {
+			return b.excludeByCascade(currentPath, descriptor, excludedType, includedByParent)
+		}
 	}
 
-	inputType := descriptor.GetInputType()
-	err = b.includeMessage(inputType, getDescriptorPath(inputType), childInclude)
-	if err != nil {
+	ok, childInclude, err := b.includeAny(currentPath, descriptor.GetFullyQualifiedName(), includedByParent)
+	if !ok {
 		return err
 	}
 
-	outputType := descriptor.GetOutputType()
-	err = b.includeMessage(outputType, getDescriptorPath(outputType), childInclude)
-	if err != nil {
-		return err
+	for _, referencedType := range referencedTypes {
+		if err := b.includeReferencedType(referencedType, childInclude); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -284,6 +615,10 @@ func (b *filterBuilder) includeService(descriptor *desc.ServiceDescriptor, path
 }
 
 func (b *filterBuilder) includeFileDescriptor(descriptor *desc.FileDescriptor, path []string, includedByParent bool) error {
+	if b.isExternal(descriptor) {
+		return nil
+	}
+
 	currentPath := append(path, descriptor.GetName())
 	ok, childInclude, err := b.includeAny(currentPath, descriptor.GetFullyQualifiedName(), includedByParent)
 	if !ok {
@@ -308,14 +643,69 @@ func (b *filterBuilder) includeFileDescriptor(descriptor *desc.FileDescriptor, p
 		}
 	}
 
+	for _, extension := range descriptor.GetExtensions() {
+		if err := b.includeExtension(extension, currentPath, childInclude); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func buildInclusions(descriptors []*desc.FileDescriptor, cfg *configuration.Configuration) (map[string]inclusionType, error) {
+// expandSelectors returns a configuration where every element matched by a selector is added to the filter trees, and
+// the paths excluded by selectors
+func expandSelectors(descriptors []*desc.FileDescriptor, cfg *configuration.Configuration) (*configuration.Configuration, map[string]bool, error) {
+	exclusions := make(map[string]bool)
+	if len(cfg.Selectors) == 0 {
+		return cfg, exclusions, nil
+	}
+
+	filtered := []*desc.FileDescriptor{}
+	for _, descriptor := range descriptors {
+		if !cfg.External.IsExternal(descriptor.GetName(), descriptor.GetPackage()) {
+			filtered = append(filtered, descriptor)
+		}
+	}
+
+	result := cfg.Clone()
+	err := selector.Walk(filtered, func(descriptor desc.Descriptor) error {
+		for _, rule := range cfg.Selectors {
+			matches, err := selector.Matches(&rule.Match, descriptor)
+			if err != nil {
+				return fmt.Errorf("Failed to match selector on %s: %w", descriptor.GetFullyQualifiedName(), err)
+			}
+			if !matches {
+				continue
+			}
+
+			path := selector.GetPath(descriptor)
+			if rule.Action == configuration.SelectorActionInclude {
+				result.AddIncludedPath(path...)
+			} else {
+				result.AddExcludedPath(path...)
+				exclusions[utils.BuildPath(path)] = true
+			}
+		}
+		return nil
+	})
+
+	return result, exclusions, err
+}
+
+func buildInclusions(descriptors []*desc.FileDescriptor, cfg *configuration.Configuration, rep *report.Report) (map[string]inclusionType, error) {
+	cfg, selectorExclusions, err := expandSelectors(descriptors, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	builder := filterBuilder{
-		isIncludedCache: make(map[string]configuration.InclusionResult),
-		configuration:   cfg,
-		inclusionMap:    make(map[string]inclusionType),
+		descriptors:        descriptors,
+		isIncludedCache:    make(map[string]configuration.InclusionResult),
+		configuration:      cfg,
+		inclusionMap:       make(map[string]inclusionType),
+		report:             rep,
+		pathAliases:        make(map[string][]string),
+		selectorExclusions: selectorExclusions,
 	}
 
 	for _, descriptor := range descriptors {
@@ -324,13 +714,36 @@ func buildInclusions(descriptors []*desc.FileDescriptor, cfg *configuration.Conf
 		}
 	}
 
+	for _, descriptor := range descriptors {
+		for _, message := range descriptor.GetMessageTypes() {
+			if err := builder.applyOneOfPolicy(message); err != nil {
+				return builder.inclusionMap, err
+			}
+			if err := builder.checkRequiredFields(message); err != nil {
+				return builder.inclusionMap, err
+			}
+		}
+	}
+
 	return builder.inclusionMap, nil
 }
 
-// BuildIncluded create a map of every file, message, enum, field  and service that can be
-// encountered and if they are included or not
-func BuildIncluded(descriptors []*desc.FileDescriptor, configuration *configuration.Configuration) (map[string]bool, error) {
-	result := make(map[string]bool)
+// Result contains the elements that can be encountered in the descriptors, and how they are included
+type Result struct {
+	// Included contains every file, message, enum, field and service that can be encountered and if they are included
+	// or not
+	Included map[string]bool
+	// Containers contains the elements that are only included to contain referenced elements
+	Containers map[string]bool
+}
+
+// BuildIncluded computes which elements of the descriptors are included, the elements removed by cascade are added to
+// the report
+func BuildIncluded(descriptors []*desc.FileDescriptor, configuration *configuration.Configuration, rep *report.Report) (*Result, error) {
+	result := &Result{
+		Included:   make(map[string]bool),
+		Containers: make(map[string]bool),
+	}
 
 	fmt.Printf("==================================================================\n")
 	fmt.Printf("==================================================================\n")
@@ -339,17 +752,20 @@ func BuildIncluded(descriptors []*desc.FileDescriptor, configuration *configurat
 	fmt.Printf("==================================================================\n")
 	fmt.Printf("==================================================================\n")
 
-	inclusions, err := buildInclusions(descriptors, configuration)
+	inclusions, err := buildInclusions(descriptors, configuration, rep)
 	if err != nil {
 		return result, err
 	}
 
 	for path, inclusionType := range inclusions {
 		switch inclusionType {
-		case inclusionTypeIncludedImplicit, inclusionTypeIncludedExplicit:
-			result[path] = true
+		case inclusionTypeIncludedImplicit, inclusionTypeIncludedExplicit, inclusionTypeIncludedContainer:
+			result.Included[path] = true
 		default:
-			result[path] = false
+			result.Included[path] = false
+		}
+		if inclusionType == inclusionTypeIncludedContainer {
+			result.Containers[path] = true
 		}
 	}
 
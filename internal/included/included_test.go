@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/vbfox/proto-filter/report"
 	"github.com/vbfox/proto-filter/testutils"
 )
 
@@ -61,9 +62,9 @@ func runIncludedTest(t *testing.T, config string, input string, expected string)
 	assert := require.New(t)
 	parsedConfig := testutils.ConfFromString(assert, config)
 	inputDesc := testutils.DescriptorSetFromString(assert, "test.proto", input)
-	result, err := BuildIncluded(inputDesc, parsedConfig)
+	result, err := BuildIncluded(inputDesc, parsedConfig, report.New())
 	assert.NoError(err)
-	actual := mapToString(result)
+	actual := mapToString(result.Included)
 
 	expectedParts := strings.Split(expected, "\n")
 	sort.Strings(expectedParts)
@@ -179,7 +180,7 @@ msg_a
 msg_a.field_a_1
 msg_b
 msg_b.msg_b_a
-msg_a.msg_b_a.field_b_a_1
+msg_b.msg_b_a.field_b_a_1
 `,
 	)
 }
@@ -401,3 +402,464 @@ svc_a.method_a_3
 `,
 	)
 }
+
+func TestEnumReference(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  enum_b field_a_1 = 1;
+}
+
+enum enum_b {
+  VALUE_B_0 = 0;
+}
+`,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+enum_b
+enum_b.VALUE_B_0
+`,
+	)
+}
+
+func TestCascadeExclusion(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+cascade_exclusions: true
+include:
+  - test.proto:
+    - msg_a
+    - svc_a
+exclude:
+  - test.proto:
+    - msg_b
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+  msg_b field_a_2 = 2;
+  map<string, msg_b> field_a_3 = 3;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+  rpc method_a_2 ( msg_a ) returns ( msg_b );
+}
+`,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+svc_a
+svc_a.method_a_1
+`,
+	)
+}
+
+const oneOfTestInput = `syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+
+  oneof payload {
+    string variant_1 = 2;
+    string variant_2 = 3;
+    string variant_3 = 4;
+  }
+}
+`
+
+func TestIncludeOneOf(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a:
+      - payload
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.payload
+msg_a.variant_1
+msg_a.variant_2
+msg_a.variant_3
+`,
+	)
+}
+
+func TestExcludeOneOf(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - payload
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+`,
+	)
+}
+
+func TestSelectOneOfMembers(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a:
+      - payload:
+        - variant_1
+      - variant_2
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.payload
+msg_a.variant_1
+msg_a.variant_2
+`,
+	)
+}
+
+func TestExcludeOneOfMember(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - payload:
+        - variant_1
+      - variant_2
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+msg_a.payload
+msg_a.variant_3
+`,
+	)
+}
+
+func TestOneOfPolicyDrop(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+oneof_policy: drop
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - variant_1
+      - variant_2
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+`,
+	)
+}
+
+func TestOneOfPolicyError(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := testutils.ConfFromString(assert, `---
+oneof_policy: error
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - variant_1
+      - variant_2
+`)
+	inputDesc := testutils.DescriptorSetFromString(assert, "test.proto", oneOfTestInput)
+	_, err := BuildIncluded(inputDesc, parsedConfig, report.New())
+	assert.Error(err)
+}
+
+func TestOneOfPolicyErrorExcludedOneOf(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+oneof_policy: error
+include:
+  - test.proto:
+    - msg_a
+exclude:
+  - test.proto:
+    - msg_a:
+      - payload
+`,
+		oneOfTestInput,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+`,
+	)
+}
+
+func TestOneOfPolicyErrorContainer(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+oneof_policy: error
+include:
+  - test.proto:
+    - msg_b
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  message msg_a_a {
+    string field_a_a_1 = 1;
+  }
+
+  oneof payload {
+    string variant_1 = 1;
+    string variant_2 = 2;
+  }
+}
+
+message msg_b {
+  msg_a.msg_a_a field_b_1 = 1;
+}
+`,
+		`
+test.proto
+msg_a
+msg_a.msg_a_a
+msg_a.msg_a_a.field_a_a_1
+msg_b
+msg_b.field_b_1
+`,
+	)
+}
+
+func TestIncludeMethodsBySelector(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+selectors:
+  - action: include
+    match:
+      kind: method
+      streaming: unary
+`,
+		`syntax = "proto3";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+message msg_b {
+  string field_b_1 = 1;
+}
+
+service svc_a {
+  rpc method_a_1 ( msg_a ) returns ( msg_a );
+
+  rpc method_a_2 ( stream msg_b ) returns ( msg_b );
+}
+`,
+		`
+test.proto
+msg_a
+msg_a.field_a_1
+svc_a
+svc_a.method_a_1
+`,
+	)
+}
+
+func TestExcludeFieldsByType(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a
+    - msg_b
+selectors:
+  - action: exclude
+    match:
+      type: auth.Credentials
+  - action: exclude
+    match:
+      type: bytes
+      name: "*_token"
+`,
+		`syntax = "proto3";
+
+package auth;
+
+message Credentials {
+  string secret = 1;
+}
+
+message msg_a {
+  Credentials creds = 1;
+  bytes session_token = 2;
+  string name = 3;
+}
+
+message msg_b {
+  map<string, Credentials> all_creds = 1;
+  bytes payload = 2;
+}
+`,
+		`
+test.proto
+auth.msg_a
+auth.msg_a.name
+auth.msg_b
+auth.msg_b.payload
+`,
+	)
+}
+
+func TestExcludeSelectorOverridesInclude(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a:
+      - creds
+      - name
+selectors:
+  - action: exclude
+    match:
+      type: auth.Credentials
+`,
+		`syntax = "proto3";
+
+package auth;
+
+message Credentials {
+  string secret = 1;
+}
+
+message msg_a {
+  Credentials creds = 1;
+  string name = 2;
+}
+`,
+		`
+test.proto
+auth.msg_a
+auth.msg_a.name
+`,
+	)
+}
+
+func TestExcludeSelectorOverridesOneOfInclude(t *testing.T) {
+	runIncludedTest(
+		t,
+		`---
+include:
+  - test.proto:
+    - msg_a:
+      - choice:
+        - creds
+        - token
+selectors:
+  - action: exclude
+    match:
+      type: auth.Credentials
+`,
+		`syntax = "proto3";
+
+package auth;
+
+message Credentials {
+  string secret = 1;
+}
+
+message msg_a {
+  oneof choice {
+    Credentials creds = 1;
+    string token = 2;
+  }
+}
+`,
+		`
+test.proto
+auth.msg_a
+auth.msg_a.choice
+auth.msg_a.token
+`,
+	)
+}
+
+func TestContainersOfReferencedTypes(t *testing.T) {
+	assert := require.New(t)
+	parsedConfig := testutils.ConfFromString(assert, `---
+include:
+  - test.proto:
+    - msg_a
+    - msg_c
+`)
+	inputDesc := testutils.DescriptorSetFromString(assert, "test.proto", `syntax = "proto3";
+
+message msg_a {
+    msg_b.msg_b_a field_a_1 = 1;
+}
+
+message msg_b {
+    message msg_b_a {
+        string field_b_a_1 = 1;
+    }
+
+    string field_b_1 = 1;
+}
+
+message msg_c {
+    message msg_c_a {
+        string field_c_a_1 = 1;
+    }
+
+    msg_c_a field_c_1 = 1;
+}
+`)
+	result, err := BuildIncluded(inputDesc, parsedConfig, report.New())
+	assert.NoError(err)
+	assert.Equal(map[string]bool{"msg_b": true}, result.Containers)
+}
@@ -0,0 +1,348 @@
+// Package optionutil reads the options of descriptors, including custom options that are only known through the
+// descriptors being filtered and not by the go protobuf registry.
+package optionutil
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+func visitFiles(file *desc.FileDescriptor, visited map[string]bool, visitor func(*desc.FileDescriptor) bool) bool {
+	if visited[file.GetName()] {
+		return false
+	}
+	visited[file.GetName()] = true
+
+	if visitor(file) {
+		return true
+	}
+
+	for _, dependency := range file.GetDependencies() {
+		if visitFiles(dependency, visited, visitor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func findExtensionInMessage(message *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	for _, extension := range message.GetNestedExtensions() {
+		if extension.GetFullyQualifiedName() == name {
+			return extension
+		}
+	}
+
+	for _, nested := range message.GetNestedMessageTypes() {
+		if extension := findExtensionInMessage(nested, name); extension != nil {
+			return extension
+		}
+	}
+
+	return nil
+}
+
+// FindExtension look for an extension by its fully qualified name in a file and its transitive dependencies
+func FindExtension(file *desc.FileDescriptor, name string) *desc.FieldDescriptor {
+	var result *desc.FieldDescriptor
+
+	visitFiles(file, map[string]bool{}, func(f *desc.FileDescriptor) bool {
+		for _, extension := range f.GetExtensions() {
+			if extension.GetFullyQualifiedName() == name {
+				result = extension
+				return true
+			}
+		}
+		for _, message := range f.GetMessageTypes() {
+			if extension := findExtensionInMessage(message, name); extension != nil {
+				result = extension
+				return true
+			}
+		}
+		return false
+	})
+
+	return result
+}
+
+func isNil(message proto.Message) bool {
+	if message == nil {
+		return true
+	}
+	value := reflect.ValueOf(message)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
+
+// GetExtension returns the value of an extension in the options of a descriptor or nil if it isn't set
+func GetExtension(descriptor desc.Descriptor, extension *desc.FieldDescriptor) (interface{}, error) {
+	options := descriptor.GetOptions()
+	if isNil(options) {
+		return nil, nil
+	}
+
+	optionsDescriptor, err := desc.LoadMessageDescriptorForMessage(options)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := dynamic.NewExtensionRegistryWithDefaults()
+	if err := registry.AddExtension(extension); err != nil {
+		return nil, err
+	}
+
+	message := dynamic.NewMessageFactoryWithExtensionRegistry(registry).NewDynamicMessage(optionsDescriptor)
+	if err := message.ConvertFrom(options); err != nil {
+		return nil, err
+	}
+
+	if !message.HasField(extension) {
+		return nil, nil
+	}
+
+	return message.TryGetField(extension)
+}
+
+// Filter returns a copy of the options containing only the options accepted by keep, standard options are named by
+// their field name (deprecated, java_package, ...) and custom options by their fully qualified name. The extensions
+// defining the custom options that were kept are also returned.
+func Filter(options proto.Message, file *desc.FileDescriptor, keep func(name string) bool) (proto.Message, []*desc.FieldDescriptor, error) {
+	if isNil(options) {
+		return nil, nil, nil
+	}
+
+	optionsDescriptor, err := desc.LoadMessageDescriptorForMessage(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registry := dynamic.NewExtensionRegistryWithDefaults()
+	registry.AddExtensionsFromFileRecursively(file)
+
+	message := dynamic.NewMessageFactoryWithExtensionRegistry(registry).NewDynamicMessage(optionsDescriptor)
+	if err := message.ConvertFrom(options); err != nil {
+		return nil, nil, err
+	}
+
+	for _, field := range message.GetKnownFields() {
+		if !field.IsExtension() && !keep(field.GetName()) {
+			message.ClearField(field)
+		}
+	}
+
+	extensions := []*desc.FieldDescriptor{}
+	for _, extension := range message.GetKnownExtensions() {
+		if keep(extension.GetFullyQualifiedName()) {
+			extensions = append(extensions, extension)
+		} else {
+			message.ClearField(extension)
+		}
+	}
+
+	result := proto.Clone(options)
+	result.Reset()
+	if err := message.ConvertTo(result); err != nil {
+		return nil, nil, err
+	}
+
+	return result, extensions, nil
+}
+
+// SetFields returns a copy of the options with standard options set, they are named by their field name
+// (go_package, java_package, ...)
+func SetFields(options proto.Message, values map[string]interface{}) (proto.Message, error) {
+	optionsDescriptor, err := desc.LoadMessageDescriptorForMessage(options)
+	if err != nil {
+		return nil, err
+	}
+
+	message := dynamic.NewMessage(optionsDescriptor)
+	if !isNil(options) {
+		if err := message.ConvertFrom(options); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range values {
+		if err := message.TrySetFieldByName(name, value); err != nil {
+			return nil, fmt.Errorf("Failed to set option %s: %w", name, err)
+		}
+	}
+
+	result := proto.Clone(options)
+	result.Reset()
+	if err := message.ConvertTo(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// newOptions returns a new empty message of the same type as the options, they can be a nil pointer
+func newOptions(options proto.Message) proto.Message {
+	return reflect.New(reflect.TypeOf(options).Elem()).Interface().(proto.Message)
+}
+
+// findOption returns the field of an option in an options message, standard options are named by their field name
+// and custom options by their fully qualified name. Nil is returned for custom options unknown to the file or
+// extending another options message.
+func findOption(optionsDescriptor *desc.MessageDescriptor, file *desc.FileDescriptor, name string) *desc.FieldDescriptor {
+	if field := optionsDescriptor.FindFieldByName(name); field != nil {
+		return field
+	}
+
+	extension := FindExtension(file, name)
+	if extension == nil || extension.GetOwner().GetFullyQualifiedName() != optionsDescriptor.GetFullyQualifiedName() {
+		return nil
+	}
+	return extension
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflectValue.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(reflectValue.Uint()), true
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	if integer, isInteger := toInt64(value); isInteger {
+		return float64(integer), true
+	}
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return reflectValue.Float(), true
+	}
+	return 0, false
+}
+
+// convertScalar convert a configuration value (string, bool, integer or float) to the go type of a field
+func convertScalar(field *desc.FieldDescriptor, value interface{}) (interface{}, error) {
+	var result interface{}
+	var ok bool
+
+	switch field.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_BOOL:
+		result, ok = value.(bool)
+	case dpb.FieldDescriptorProto_TYPE_STRING:
+		result, ok = value.(string)
+	case dpb.FieldDescriptorProto_TYPE_BYTES:
+		var text string
+		text, ok = value.(string)
+		result = []byte(text)
+	case dpb.FieldDescriptorProto_TYPE_ENUM:
+		if name, isName := value.(string); isName {
+			if enumValue := field.GetEnumType().FindValueByName(name); enumValue != nil {
+				return enumValue.GetNumber(), nil
+			}
+			return nil, fmt.Errorf("Unknown value %s for enum %s", name, field.GetEnumType().GetFullyQualifiedName())
+		}
+		var number int64
+		number, ok = toInt64(value)
+		result = int32(number)
+	case dpb.FieldDescriptorProto_TYPE_INT32, dpb.FieldDescriptorProto_TYPE_SINT32,
+		dpb.FieldDescriptorProto_TYPE_SFIXED32:
+		var number int64
+		number, ok = toInt64(value)
+		result = int32(number)
+	case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64,
+		dpb.FieldDescriptorProto_TYPE_SFIXED64:
+		result, ok = toInt64(value)
+	case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_FIXED32:
+		var number int64
+		number, ok = toInt64(value)
+		result = uint32(number)
+	case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_FIXED64:
+		var number int64
+		number, ok = toInt64(value)
+		result = uint64(number)
+	case dpb.FieldDescriptorProto_TYPE_FLOAT:
+		var number float64
+		number, ok = toFloat64(value)
+		result = float32(number)
+	case dpb.FieldDescriptorProto_TYPE_DOUBLE:
+		result, ok = toFloat64(value)
+	default:
+		return nil, fmt.Errorf("Options of type %s can't be set", field.GetType())
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid value %v for an option of type %s", value, field.GetType())
+	}
+	return result, nil
+}
+
+func convertValue(field *desc.FieldDescriptor, value interface{}) (interface{}, error) {
+	if !field.IsRepeated() {
+		return convertScalar(field, value)
+	}
+
+	values, isList := value.([]interface{})
+	if !isList {
+		values = []interface{}{value}
+	}
+	result := make([]interface{}, len(values))
+	for i, element := range values {
+		converted, err := convertScalar(field, element)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = converted
+	}
+	return result, nil
+}
+
+// Set returns a copy of the options with options set from configuration values, standard options are named by their
+// field name and custom options by their fully qualified name. Options that don't exist for this kind of options or
+// that are unknown to the file are ignored. The extensions defining the custom options that were set are also returned.
+func Set(options proto.Message, file *desc.FileDescriptor, values map[string]interface{}) (proto.Message, []*desc.FieldDescriptor, error) {
+	optionsDescriptor, err := desc.LoadMessageDescriptorForMessage(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registry := dynamic.NewExtensionRegistryWithDefaults()
+	registry.AddExtensionsFromFileRecursively(file)
+
+	message := dynamic.NewMessageFactoryWithExtensionRegistry(registry).NewDynamicMessage(optionsDescriptor)
+	if !isNil(options) {
+		if err := message.ConvertFrom(options); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	extensions := []*desc.FieldDescriptor{}
+	for name, value := range values {
+		field := findOption(optionsDescriptor, file, name)
+		if field == nil {
+			continue
+		}
+
+		converted, err := convertValue(field, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to set option %s: %w", name, err)
+		}
+		if err := message.TrySetField(field, converted); err != nil {
+			return nil, nil, fmt.Errorf("Failed to set option %s: %w", name, err)
+		}
+		if field.IsExtension() {
+			extensions = append(extensions, field)
+		}
+	}
+
+	result := newOptions(options)
+	if err := message.ConvertTo(result); err != nil {
+		return nil, nil, err
+	}
+
+	return result, extensions, nil
+}
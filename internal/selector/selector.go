@@ -0,0 +1,327 @@
+// Package selector match the selectors of a configuration against descriptors.
+package selector
+
+import (
+	"path"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/optionutil"
+	"github.com/vbfox/proto-filter/internal/utils"
+)
+
+const httpAnnotationName = "google.api.http"
+
+// GetKind returns the kind of element a descriptor represents
+func GetKind(descriptor desc.Descriptor) configuration.ElementKind {
+	switch typed := descriptor.(type) {
+	case *desc.FileDescriptor:
+		return configuration.ElementKindFile
+	case *desc.MessageDescriptor:
+		return configuration.ElementKindMessage
+	case *desc.FieldDescriptor:
+		if typed.IsExtension() {
+			return configuration.ElementKindExtension
+		}
+		return configuration.ElementKindField
+	case *desc.OneOfDescriptor:
+		return configuration.ElementKindOneOf
+	case *desc.EnumDescriptor:
+		return configuration.ElementKindEnum
+	case *desc.EnumValueDescriptor:
+		return configuration.ElementKindEnumValue
+	case *desc.ServiceDescriptor:
+		return configuration.ElementKindService
+	case *desc.MethodDescriptor:
+		return configuration.ElementKindMethod
+	}
+	return ""
+}
+
+// GetPath returns the path of an element as used in the filter tree of the configuration
+func GetPath(descriptor desc.Descriptor) []string {
+	result := []string{}
+	for current := descriptor; current != nil; current = current.GetParent() {
+		result = append([]string{current.GetName()}, result...)
+	}
+	return result
+}
+
+func matchGlob(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+func getStreaming(descriptor *desc.MethodDescriptor) string {
+	switch {
+	case descriptor.IsClientStreaming() && descriptor.IsServerStreaming():
+		return configuration.StreamingBidi
+	case descriptor.IsClientStreaming():
+		return configuration.StreamingClient
+	case descriptor.IsServerStreaming():
+		return configuration.StreamingServer
+	default:
+		return configuration.StreamingUnary
+	}
+}
+
+// getHTTPRule returns the HTTP method and path from the `google.api.http` annotation of a method
+func getHTTPRule(descriptor *desc.MethodDescriptor) (string, string, bool, error) {
+	extension := optionutil.FindExtension(descriptor.GetFile(), httpAnnotationName)
+	if extension == nil {
+		return "", "", false, nil
+	}
+
+	value, err := optionutil.GetExtension(descriptor, extension)
+	if err != nil || value == nil {
+		return "", "", false, err
+	}
+
+	rule, ok := value.(*dynamic.Message)
+	if !ok {
+		return "", "", true, nil
+	}
+
+	for _, method := range []string{"get", "put", "post", "delete", "patch"} {
+		if pattern, err := rule.TryGetFieldByName(method); err == nil {
+			if patternString, ok := pattern.(string); ok && patternString != "" {
+				return method, patternString, true, nil
+			}
+		}
+	}
+
+	if custom, err := rule.TryGetFieldByName("custom"); err == nil {
+		if customMessage, ok := custom.(*dynamic.Message); ok && customMessage != nil {
+			kind, _ := customMessage.TryGetFieldByName("kind")
+			pattern, _ := customMessage.TryGetFieldByName("path")
+			kindString, _ := kind.(string)
+			patternString, _ := pattern.(string)
+			return strings.ToLower(kindString), patternString, true, nil
+		}
+	}
+
+	return "", "", true, nil
+}
+
+func matchesMethod(s *configuration.Selector, descriptor *desc.MethodDescriptor) (bool, error) {
+	if s.Streaming != "" && s.Streaming != getStreaming(descriptor) {
+		return false, nil
+	}
+
+	if s.HTTP == "" && s.HTTPMethod == "" && s.HTTPPath == "" {
+		return true, nil
+	}
+
+	method, pattern, found, err := getHTTPRule(descriptor)
+	if err != nil {
+		return false, err
+	}
+
+	if s.HTTP == configuration.HTTPAbsent {
+		return !found, nil
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	if s.HTTPMethod != "" && !strings.EqualFold(s.HTTPMethod, method) {
+		return false, nil
+	}
+
+	return matchGlob(s.HTTPPath, pattern), nil
+}
+
+func getLabel(descriptor *desc.FieldDescriptor) string {
+	switch {
+	case descriptor.IsMap():
+		return configuration.LabelMap
+	case descriptor.IsRepeated():
+		return configuration.LabelRepeated
+	case descriptor.IsRequired():
+		return configuration.LabelRequired
+	default:
+		return configuration.LabelOptional
+	}
+}
+
+// getType returns the kind and name of the type of a field, as matched by the type selectors
+func getType(descriptor *desc.FieldDescriptor) (string, string) {
+	if descriptor.IsMap() {
+		return getType(descriptor.GetMapValueType())
+	}
+
+	if messageType := descriptor.GetMessageType(); messageType != nil {
+		return configuration.TypeKindMessage, messageType.GetFullyQualifiedName()
+	}
+
+	if enumType := descriptor.GetEnumType(); enumType != nil {
+		return configuration.TypeKindEnum, enumType.GetFullyQualifiedName()
+	}
+
+	// TYPE_BYTES -> bytes
+	name := strings.TrimPrefix(descriptor.GetType().String(), "TYPE_")
+	return configuration.TypeKindScalar, strings.ToLower(name)
+}
+
+func matchesField(s *configuration.Selector, descriptor *desc.FieldDescriptor) bool {
+	if s.Label != "" && s.Label != getLabel(descriptor) {
+		return false
+	}
+
+	typeKind, typeName := getType(descriptor)
+	if s.TypeKind != "" && s.TypeKind != typeKind {
+		return false
+	}
+
+	if s.MapKeyType != "" || s.MapValueType != "" {
+		if !descriptor.IsMap() {
+			return false
+		}
+		_, keyTypeName := getType(descriptor.GetMapKeyType())
+		_, valueTypeName := getType(descriptor.GetMapValueType())
+		if !matchGlob(s.MapKeyType, keyTypeName) || !matchGlob(s.MapValueType, valueTypeName) {
+			return false
+		}
+	}
+
+	return matchGlob(s.Type, typeName)
+}
+
+// Matches returns true if the selector matches the element
+func Matches(s *configuration.Selector, descriptor desc.Descriptor) (bool, error) {
+	kind := GetKind(descriptor)
+	if s.Kind != "" && s.Kind != kind {
+		return false, nil
+	}
+
+	if !matchGlob(s.Name, descriptor.GetName()) {
+		return false, nil
+	}
+
+	if !matchGlob(s.Path, utils.BuildPath(GetPath(descriptor))) {
+		return false, nil
+	}
+
+	if s.IsMethodOnly() {
+		method, isMethod := descriptor.(*desc.MethodDescriptor)
+		if !isMethod {
+			return false, nil
+		}
+		return matchesMethod(s, method)
+	}
+
+	if s.IsFieldOnly() {
+		field, isField := descriptor.(*desc.FieldDescriptor)
+		if !isField {
+			return false, nil
+		}
+		if s.Extendee != "" && (!field.IsExtension() || !matchGlob(s.Extendee, field.GetOwner().GetFullyQualifiedName())) {
+			return false, nil
+		}
+		return matchesField(s, field), nil
+	}
+
+	return true, nil
+}
+
+func walkMessage(descriptor *desc.MessageDescriptor, visitor func(desc.Descriptor) error) error {
+	if descriptor.IsMapEntry() {
+		return nil
+	}
+
+	if err := visitor(descriptor); err != nil {
+		return err
+	}
+
+	for _, message := range descriptor.GetNestedMessageTypes() {
+		if err := walkMessage(message, visitor); err != nil {
+			return err
+		}
+	}
+
+	for _, enum := range descriptor.GetNestedEnumTypes() {
+		if err := walkEnum(enum, visitor); err != nil {
+			return err
+		}
+	}
+
+	for _, oneOf := range descriptor.GetOneOfs() {
+		if err := visitor(oneOf); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range descriptor.GetFields() {
+		if err := visitor(field); err != nil {
+			return err
+		}
+	}
+
+	for _, extension := range descriptor.GetNestedExtensions() {
+		if err := visitor(extension); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkEnum(descriptor *desc.EnumDescriptor, visitor func(desc.Descriptor) error) error {
+	if err := visitor(descriptor); err != nil {
+		return err
+	}
+
+	for _, value := range descriptor.GetValues() {
+		if err := visitor(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Walk call the visitor for every element of the files
+func Walk(files []*desc.FileDescriptor, visitor func(desc.Descriptor) error) error {
+	for _, file := range files {
+		if err := visitor(file); err != nil {
+			return err
+		}
+
+		for _, message := range file.GetMessageTypes() {
+			if err := walkMessage(message, visitor); err != nil {
+				return err
+			}
+		}
+
+		for _, enum := range file.GetEnumTypes() {
+			if err := walkEnum(enum, visitor); err != nil {
+				return err
+			}
+		}
+
+		for _, service := range file.GetServices() {
+			if err := visitor(service); err != nil {
+				return err
+			}
+			for _, method := range service.GetMethods() {
+				if err := visitor(method); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, extension := range file.GetExtensions() {
+			if err := visitor(extension); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
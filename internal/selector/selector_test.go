@@ -0,0 +1,265 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/require"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/testutils"
+)
+
+var httpFiles = map[string]string{
+	"google/api/http.proto": `syntax = "proto3";
+package google.api;
+
+message HttpRule {
+  oneof pattern {
+    string get = 2;
+    string put = 3;
+    string post = 4;
+    string delete = 5;
+    string patch = 6;
+    CustomHttpPattern custom = 8;
+  }
+  string body = 7;
+}
+
+message CustomHttpPattern {
+  string kind = 1;
+  string path = 2;
+}
+`,
+	"google/api/annotations.proto": `syntax = "proto3";
+package google.api;
+
+import "google/api/http.proto";
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.MethodOptions {
+  HttpRule http = 72295728;
+}
+`,
+	"test.proto": `syntax = "proto3";
+
+import "google/api/annotations.proto";
+
+message msg_a {
+  string field_a_1 = 1;
+}
+
+service svc_a {
+  rpc unary_get ( msg_a ) returns ( msg_a ) {
+    option (google.api.http) = { get: "/v1/a/{field_a_1}" };
+  }
+
+  rpc unary_post ( msg_a ) returns ( msg_a ) {
+    option (google.api.http) = { post: "/v1/a" body: "*" };
+  }
+
+  rpc unary_custom ( msg_a ) returns ( msg_a ) {
+    option (google.api.http) = { custom: { kind: "HEAD" path: "/v1/a" } };
+  }
+
+  rpc unary_none ( msg_a ) returns ( msg_a );
+
+  rpc client ( stream msg_a ) returns ( msg_a );
+
+  rpc server ( msg_a ) returns ( stream msg_a );
+
+  rpc bidi ( stream msg_a ) returns ( stream msg_a );
+}
+`,
+}
+
+func matchingMethods(assert *require.Assertions, s *configuration.Selector) []string {
+	files := testutils.DescriptorSetFromFiles(assert, httpFiles, "test.proto")
+	result := []string{}
+	err := Walk(files, func(descriptor desc.Descriptor) error {
+		matches, err := Matches(s, descriptor)
+		if matches {
+			result = append(result, descriptor.GetName())
+		}
+		return err
+	})
+	assert.NoError(err)
+	return result
+}
+
+func TestMatchStreaming(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"unary_get", "unary_post", "unary_custom", "unary_none"},
+		matchingMethods(assert, &configuration.Selector{Streaming: configuration.StreamingUnary}))
+	assert.Equal(
+		[]string{"client"},
+		matchingMethods(assert, &configuration.Selector{Streaming: configuration.StreamingClient}))
+	assert.Equal(
+		[]string{"server"},
+		matchingMethods(assert, &configuration.Selector{Streaming: configuration.StreamingServer}))
+	assert.Equal(
+		[]string{"bidi"},
+		matchingMethods(assert, &configuration.Selector{Streaming: configuration.StreamingBidi}))
+}
+
+func TestMatchHTTP(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"unary_get", "unary_post", "unary_custom"},
+		matchingMethods(assert, &configuration.Selector{HTTP: configuration.HTTPPresent}))
+	assert.Equal(
+		[]string{"unary_none", "client", "server", "bidi"},
+		matchingMethods(assert, &configuration.Selector{HTTP: configuration.HTTPAbsent}))
+	assert.Equal(
+		[]string{"unary_post"},
+		matchingMethods(assert, &configuration.Selector{HTTPMethod: "POST"}))
+	assert.Equal(
+		[]string{"unary_custom"},
+		matchingMethods(assert, &configuration.Selector{HTTPMethod: "head"}))
+	assert.Equal(
+		[]string{"unary_get"},
+		matchingMethods(assert, &configuration.Selector{HTTPPath: "/v1/a/*"}))
+}
+
+func TestMatchNameAndPath(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"unary_get", "unary_post", "unary_custom", "unary_none"},
+		matchingMethods(assert, &configuration.Selector{Kind: configuration.ElementKindMethod, Name: "unary_*"}))
+	assert.Equal(
+		[]string{"field_a_1"},
+		matchingMethods(assert, &configuration.Selector{Path: "test.proto/msg_a/*"}))
+}
+
+const typesFile = `syntax = "proto3";
+
+package acme;
+
+message Credentials {
+  string secret = 1;
+}
+
+enum Kind {
+  KIND_UNKNOWN = 0;
+}
+
+message msg_a {
+  Credentials creds = 1;
+  bytes session_token = 2;
+  string name_token = 3;
+  repeated bytes blobs = 4;
+  map<string, Credentials> all_creds = 5;
+  Kind kind = 6;
+}
+`
+
+func matchingFields(assert *require.Assertions, s *configuration.Selector) []string {
+	files := testutils.DescriptorSetFromString(assert, "test.proto", typesFile)
+	result := []string{}
+	err := Walk(files, func(descriptor desc.Descriptor) error {
+		matches, err := Matches(s, descriptor)
+		if matches {
+			result = append(result, descriptor.GetName())
+		}
+		return err
+	})
+	assert.NoError(err)
+	return result
+}
+
+func TestMatchType(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"creds", "all_creds"},
+		matchingFields(assert, &configuration.Selector{Type: "acme.Credentials"}))
+	assert.Equal(
+		[]string{"session_token"},
+		matchingFields(assert, &configuration.Selector{Type: "bytes", Name: "*_token"}))
+	assert.Equal(
+		[]string{"kind"},
+		matchingFields(assert, &configuration.Selector{TypeKind: configuration.TypeKindEnum}))
+	assert.Equal(
+		[]string{"secret", "session_token", "name_token", "blobs"},
+		matchingFields(assert, &configuration.Selector{TypeKind: configuration.TypeKindScalar}))
+}
+
+func TestMatchLabel(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"blobs"},
+		matchingFields(assert, &configuration.Selector{Label: configuration.LabelRepeated}))
+	assert.Equal(
+		[]string{"all_creds"},
+		matchingFields(assert, &configuration.Selector{Label: configuration.LabelMap}))
+	assert.Equal(
+		[]string{"blobs"},
+		matchingFields(assert, &configuration.Selector{Label: configuration.LabelRepeated, Type: "bytes"}))
+}
+
+func TestMatchMapTypes(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"all_creds"},
+		matchingFields(assert, &configuration.Selector{MapValueType: "acme.*"}))
+	assert.Equal(
+		[]string{"all_creds"},
+		matchingFields(assert, &configuration.Selector{MapKeyType: "string"}))
+	assert.Equal(
+		[]string{},
+		matchingFields(assert, &configuration.Selector{MapKeyType: "int32"}))
+}
+
+const extensionsFile = `syntax = "proto2";
+
+package acme;
+
+message msg_a {
+  extensions 100 to 199;
+}
+
+message msg_b {
+  extensions 100 to 199;
+
+  extend msg_a {
+    optional string nested_ext = 101;
+  }
+}
+
+extend msg_a {
+  optional string ext_a = 100;
+}
+
+extend msg_b {
+  optional string ext_b = 100;
+}
+`
+
+func TestMatchExtensions(t *testing.T) {
+	assert := require.New(t)
+	files := testutils.DescriptorSetFromString(assert, "test.proto", extensionsFile)
+	matching := func(s *configuration.Selector) []string {
+		result := []string{}
+		err := Walk(files, func(descriptor desc.Descriptor) error {
+			matches, err := Matches(s, descriptor)
+			if matches {
+				result = append(result, descriptor.GetName())
+			}
+			return err
+		})
+		assert.NoError(err)
+		return result
+	}
+
+	assert.Equal(
+		[]string{"nested_ext", "ext_a", "ext_b"},
+		matching(&configuration.Selector{Kind: configuration.ElementKindExtension}))
+	assert.Equal(
+		[]string{"nested_ext", "ext_a"},
+		matching(&configuration.Selector{Extendee: "acme.msg_a"}))
+}
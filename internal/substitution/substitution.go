@@ -0,0 +1,109 @@
+// Package substitution replace the types of fields as configured by the type substitutions of a configuration.
+package substitution
+
+import (
+	"fmt"
+
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/vbfox/proto-filter/configuration"
+	"github.com/vbfox/proto-filter/internal/selector"
+
+	// Register the well-known types most commonly used as substitutes, so that they can be found even if no input
+	// file imports them
+	_ "github.com/golang/protobuf/ptypes/any"
+	_ "github.com/golang/protobuf/ptypes/empty"
+)
+
+// Find returns the substitution applying to a field or nil if the field type isn't substituted
+func Find(cfg *configuration.Configuration, descriptor *desc.FieldDescriptor) (*configuration.TypeSubstitution, error) {
+	for _, substitution := range cfg.Substitutions {
+		matches, err := selector.Matches(&substitution.Match, descriptor)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to match substitution on %s: %w", descriptor.GetFullyQualifiedName(), err)
+		}
+		if matches {
+			return substitution, nil
+		}
+	}
+	return nil, nil
+}
+
+func findMessageInFiles(files []*desc.FileDescriptor, name string, visited map[string]bool) *desc.MessageDescriptor {
+	for _, file := range files {
+		if visited[file.GetName()] {
+			continue
+		}
+		visited[file.GetName()] = true
+
+		if message, ok := file.FindSymbol(name).(*desc.MessageDescriptor); ok {
+			return message
+		}
+
+		if message := findMessageInFiles(file.GetDependencies(), name, visited); message != nil {
+			return message
+		}
+	}
+	return nil
+}
+
+// ResolveMessage find the message used as a substitute in the files or their dependencies, falling back to the
+// messages known by the go protobuf registry
+func ResolveMessage(files []*desc.FileDescriptor, name string) (*desc.MessageDescriptor, error) {
+	if message := findMessageInFiles(files, name, map[string]bool{}); message != nil {
+		return message, nil
+	}
+
+	message, err := desc.LoadMessageDescriptor(name)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, fmt.Errorf("Unknown substitute message %s", name)
+	}
+	return message, nil
+}
+
+func isLengthDelimited(descriptor *desc.FieldDescriptor) bool {
+	switch descriptor.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_MESSAGE, dpb.FieldDescriptorProto_TYPE_BYTES, dpb.FieldDescriptorProto_TYPE_STRING:
+		return true
+	}
+	return false
+}
+
+// isSubsetOf returns true if every field of the message exists in the original message with the same number and type
+func isSubsetOf(message *desc.MessageDescriptor, original *desc.MessageDescriptor) bool {
+	for _, field := range message.GetFields() {
+		originalField := original.FindFieldByNumber(field.GetNumber())
+		if originalField == nil || originalField.GetType() != field.GetType() ||
+			originalField.IsRepeated() != field.IsRepeated() {
+			return false
+		}
+
+		if field.GetMessageType() != nil && field.GetMessageType().GetFullyQualifiedName() !=
+			originalField.GetMessageType().GetFullyQualifiedName() {
+			return false
+		}
+	}
+	return true
+}
+
+// IsWireCompatible returns true if a field can be substituted by the message (Or by `bytes` if message is nil) while
+// staying readable by consumers of the original schema
+func IsWireCompatible(descriptor *desc.FieldDescriptor, message *desc.MessageDescriptor) bool {
+	if !isLengthDelimited(descriptor) {
+		return false
+	}
+
+	if message == nil {
+		return true
+	}
+
+	original := descriptor.GetMessageType()
+	if original == nil {
+		return false
+	}
+
+	return isSubsetOf(message, original)
+}
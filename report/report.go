@@ -0,0 +1,84 @@
+// Package report collects the changes made while filtering that weren't directly requested by the configuration.
+//
+// It allows users to review what happened to their schemas (Elements removed by cascade, ...) without having to diff
+// the input and the output.
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+type EntryKind int
+
+const (
+	// CascadedRemoval is reported when an element is removed because it references an excluded type
+	CascadedRemoval EntryKind = iota
+	// Warning is reported for changes that are allowed by the configuration but can break compatibility
+	Warning
+	// Redaction is reported for each change made to a comment by the comment transforms
+	Redaction
+	// Rename is reported for each element renamed by the configuration
+	Rename
+	// Hoist is reported for each nested type moved to the top level because its parent was only a container
+	Hoist
+)
+
+func (k EntryKind) String() string {
+	return [...]string{
+		"CascadedRemoval",
+		"Warning",
+		"Redaction",
+		"Rename",
+		"Hoist",
+	}[k]
+}
+
+type Entry struct {
+	Kind EntryKind
+	// Element is the fully qualified name of the element concerned
+	Element string
+	Message string
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("[%v] %s: %s", e.Kind, e.Element, e.Message)
+}
+
+type Report struct {
+	Entries []Entry
+}
+
+func New() *Report {
+	return &Report{
+		Entries: []Entry{},
+	}
+}
+
+func (r *Report) Add(kind EntryKind, element string, format string, args ...interface{}) {
+	r.Entries = append(r.Entries, Entry{
+		Kind:    kind,
+		Element: element,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// OfKind returns all the entries of a specific kind
+func (r *Report) OfKind(kind EntryKind) []Entry {
+	result := []Entry{}
+	for _, entry := range r.Entries {
+		if entry.Kind == kind {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (r *Report) String() string {
+	var str strings.Builder
+	for _, entry := range r.Entries {
+		str.WriteString(entry.String())
+		str.WriteString("\n")
+	}
+	return str.String()
+}
@@ -41,6 +41,7 @@ func DescriptorSetFromString(assert *require.Assertions, path string, content st
 			reader := readerNoCloser{Reader: buf}
 			return reader, nil
 		},
+		IncludeSourceCodeInfo: true,
 	}
 	desc, err := parser.ParseFiles(path)
 	assert.NoError(err)
@@ -49,6 +50,19 @@ func DescriptorSetFromString(assert *require.Assertions, path string, content st
 	return desc
 }
 
+// DescriptorSetFromFiles parse a set of files given by name and content, returning the descriptors of the files
+// listed in paths (Other files can be imported by them)
+func DescriptorSetFromFiles(assert *require.Assertions, files map[string]string, paths ...string) []*desc.FileDescriptor {
+	parser := protoparse.Parser{
+		Accessor:              protoparse.FileContentsFromMap(files),
+		IncludeSourceCodeInfo: true,
+	}
+	desc, err := parser.ParseFiles(paths...)
+	assert.NoError(err)
+	assert.Len(desc, len(paths))
+	return desc
+}
+
 type writerNoCloser struct {
 	Writer io.Writer
 }